@@ -0,0 +1,25 @@
+
+
+Original.proto"
+Person
+aardvark (Raardvark
+aardwolf (Raardwolf
+aaron (Raaron
+aback (Raback
+abacus (Rabacus
+abaft (Rabaft
+abalone (Rabalone
+abandon (Rabandon
+	abandoned	 (R	abandoned 
+abandonment
+ (Rabandonment
+abandons (Rabandons
+abase (Rabase
+abased (Rabased
+	abasement (R	abasement
+abash (Rabash
+abashed (Rabashed
+abate (Rabate
+abated (Rabated
+	abatement (R	abatement
+abates (Rabates
\ No newline at end of file
@@ -0,0 +1,363 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command protocompat checks two versions of a .proto file for compatibility.
+// Either version may also be given as a binary or JSON encoded
+// FileDescriptorSet, as written by protoc --descriptor_set_out --include_imports.
+// With --git-ref the older version is read from a revision of the enclosing git
+// repository instead of the working tree, and --old defaults to --new.
+// --new and --old may be repeated to compare several files at once, whose
+// sets are merged, so that extensions declared in files compiled separately
+// are checked against each other.
+//
+// Usage:
+//
+//	protocompat check   --new FILE... [--old FILE...] [--git-ref REVISION] [-I PATH]... [--format FORMAT] [--enum-policy POLICY] [--require-reserved] [--mode MODE] [--fail-on LEVEL]
+//	protocompat diff    --new FILE... [--old FILE...] [--git-ref REVISION] [-I PATH]... [--format FORMAT] [--enum-policy POLICY] [--require-reserved] [--mode MODE]
+//	protocompat explain [CONDITION]
+//
+// check prints every difference and exits non-zero if a difference at or
+// above the --fail-on level was found. diff prints every difference and only
+// fails when the input cannot be read or compared. explain describes the rule behind a
+// condition, or lists all conditions when none is given.
+//
+// Exit codes:
+//
+//	0  the versions are compatible
+//	1  the versions are incompatible
+//	2  invalid command line
+//	3  an input file could not be parsed
+//	4  the versions could not be compared or the report could not be written
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"github.com/igfe/compatibility"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	exitCompatible   = 0
+	exitIncompatible = 1
+	exitUsage        = 2
+	exitInput        = 3
+	exitFailure      = 4
+)
+
+const usage = `Usage:
+  protocompat check   --new FILE... [--old FILE...] [--git-ref REVISION] [-I PATH]... [--format FORMAT] [--enum-policy POLICY] [--require-reserved] [--mode MODE] [--fail-on LEVEL]
+  protocompat diff    --new FILE... [--old FILE...] [--git-ref REVISION] [-I PATH]... [--format FORMAT] [--enum-policy POLICY] [--require-reserved] [--mode MODE]
+  protocompat explain [CONDITION]
+
+FILE is a .proto file, or a binary or JSON encoded FileDescriptorSet.
+--new and --old may be repeated, and the files of each version are merged.
+FORMAT is text, json for a report listing every difference with its
+condition, severity, rule ID, file, path and values, sarif for a SARIF
+2.1.0 log for code scanning tools, or junit for a JUnit XML report with a
+test case per compared message, enum and service.
+--git-ref reads the older version, including its imports, from a revision
+(tag, branch or commit) of the enclosing git repository. --old then defaults
+to --new.
+MODE is the direction in which the versions must stay compatible: backward
+when newer readers read older data, forward when older readers read newer
+data, or full for both. Errors only breaking the other direction are
+reported as warnings.
+
+Commands:
+  check    compare two versions and fail if they are incompatible
+  diff     print every difference between two versions
+  explain  describe a condition, or list all conditions
+
+Exit codes:
+  0  the versions are compatible
+  1  the versions are incompatible
+  2  invalid command line
+  3  an input file could not be parsed
+  4  the versions could not be compared or the report could not be written
+`
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ":")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type options struct {
+	newer      stringList
+	older      stringList
+	gitRef     string
+	include    stringList
+	format     string
+	enumPolicy string
+	reserved   bool
+	mode       string
+	failOn     string
+}
+
+var enumPolicies = map[string]compatibility.EnumPolicy{
+	"openness": compatibility.EnumPolicyOpenness,
+	"strict":   compatibility.EnumPolicyStrict,
+	"lenient":  compatibility.EnumPolicyLenient,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "check", "diff":
+		return compare(args[0], args[1:], stdout, stderr)
+	case "explain":
+		return explain(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitCompatible
+	}
+	fmt.Fprintf(stderr, "protocompat: unknown command %q\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+func compare(command string, args []string, stdout, stderr io.Writer) int {
+	var opts options
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(&opts.newer, "new", "newer .proto or descriptor set `file`, may be repeated")
+	flags.Var(&opts.older, "old", "older .proto or descriptor set `file`, may be repeated")
+	flags.StringVar(&opts.gitRef, "git-ref", "", "read the older version from this git `revision` instead of the working tree")
+	flags.Var(&opts.include, "I", "import `path` used for both versions, may be repeated")
+	flags.StringVar(&opts.format, "format", "text", "output `format`: text, json, sarif or junit")
+	flags.StringVar(&opts.enumPolicy, "enum-policy", "openness", "`policy` for added enum values: openness reports errors for closed enums only, strict always and lenient never")
+	flags.BoolVar(&opts.reserved, "require-reserved", false, "report fields removed without reserving their number and name as errors")
+	flags.StringVar(&opts.mode, "mode", "full", "compatibility `mode`: backward, forward or full")
+	if command == "check" {
+		flags.StringVar(&opts.failOn, "fail-on", "error", "fail on differences of this `level` or above: error, lossy, warning or none")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if len(opts.older) == 0 && opts.gitRef != "" {
+		opts.older = opts.newer
+	}
+	if len(opts.newer) == 0 || len(opts.older) == 0 || flags.NArg() != 0 {
+		fmt.Fprintf(stderr, "protocompat %s: --new and --old (or --git-ref) are required\n", command)
+		flags.Usage()
+		return exitUsage
+	}
+	switch opts.format {
+	case "text", "json", "sarif", "junit":
+	default:
+		fmt.Fprintf(stderr, "protocompat %s: unknown format %q\n", command, opts.format)
+		return exitUsage
+	}
+	policy, ok := enumPolicies[opts.enumPolicy]
+	if !ok {
+		fmt.Fprintf(stderr, "protocompat %s: unknown --enum-policy %q\n", command, opts.enumPolicy)
+		return exitUsage
+	}
+	var mode compatibility.Mode
+	if err := mode.UnmarshalText([]byte(opts.mode)); err != nil {
+		fmt.Fprintf(stderr, "protocompat %s: unknown --mode %q\n", command, opts.mode)
+		return exitUsage
+	}
+	fail := opts.failOn != "" && opts.failOn != "none"
+	var failOn compatibility.Severity
+	if fail {
+		if err := failOn.UnmarshalText([]byte(opts.failOn)); err != nil || failOn == compatibility.SeverityInfo {
+			fmt.Fprintf(stderr, "protocompat %s: unknown --fail-on level %q\n", command, opts.failOn)
+			return exitUsage
+		}
+	}
+
+	newer, err := readAll(opts.newer, func(file string) (*descriptor.FileDescriptorSet, error) {
+		return parse(file, opts.include)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "protocompat %s: %v\n", command, err)
+		return exitInput
+	}
+	older, err := readAll(opts.older, func(file string) (*descriptor.FileDescriptorSet, error) {
+		if opts.gitRef != "" {
+			return compatibility.ReadGitFile(opts.gitRef, file, importPaths(file, opts.include)...)
+		}
+		return parse(file, opts.include)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "protocompat %s: %v\n", command, err)
+		return exitInput
+	}
+	c := compatibility.Comparer{Newer: newer, Older: older, EnumPolicy: policy, RequireReserved: opts.reserved, Mode: mode}
+	d, err := c.Compare()
+	if err != nil {
+		fmt.Fprintf(stderr, "protocompat %s: %v\n", command, err)
+		return exitFailure
+	}
+	if opts.format == "sarif" {
+		paths := append([]string{}, opts.include...)
+		for _, file := range opts.newer {
+			paths = append(paths, filepath.Dir(file))
+		}
+		locate(&d, paths)
+	}
+	if err := write(stdout, opts.format, d); err != nil {
+		fmt.Fprintf(stderr, "protocompat %s: %v\n", command, err)
+		return exitFailure
+	}
+
+	if fail && fails(d, failOn) {
+		return exitIncompatible
+	}
+	return exitCompatible
+}
+
+// fails reports whether d holds a difference at least as serious as level.
+// Informational differences, such as moved messages, are less serious than
+// warnings and never fail a check.
+func fails(d compatibility.DifferenceList, level compatibility.Severity) bool {
+	for _, list := range [][]compatibility.Difference{d.Error, d.Warning} {
+		for _, val := range list {
+			if val.Severity >= level {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// report is the json output of check and diff.
+type report struct {
+	Compatible  bool                       `json:"compatible"`
+	Differences []compatibility.Difference `json:"differences"`
+}
+
+func write(w io.Writer, format string, d compatibility.DifferenceList) error {
+	switch format {
+	case "text":
+		_, err := fmt.Fprint(w, d.String(false))
+		return err
+	case "sarif", "junit":
+		render := d.SARIF
+		if format == "junit" {
+			render = d.JUnit
+		}
+		data, err := render()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	r := report{Compatible: d.IsCompatible(), Differences: []compatibility.Difference{}}
+	r.Differences = append(r.Differences, d.Error...)
+	r.Differences = append(r.Differences, d.Warning...)
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// locate replaces the newer file of every difference with its path below the
+// first import path containing it, so that code scanning tools can find it.
+func locate(d *compatibility.DifferenceList, paths []string) {
+	for _, list := range [][]compatibility.Difference{d.Error, d.Warning} {
+		for i := range list {
+			list[i].File = find(list[i].File, paths)
+			if list[i].NewLocation != nil {
+				location := *list[i].NewLocation
+				location.File = find(location.File, paths)
+				list[i].NewLocation = &location
+			}
+		}
+	}
+}
+
+func find(file string, paths []string) string {
+	if file == "" {
+		return file
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(filepath.Join(path, file)); err == nil {
+			return filepath.ToSlash(filepath.Join(path, file))
+		}
+	}
+	return file
+}
+
+// parse reads a .proto file or descriptor set. A .proto file searches its
+// own directory for imports before the shared include paths.
+// readAll reads every file of a version and merges their sets, keeping a
+// single copy of the files they share, such as common imports.
+func readAll(files []string, read func(string) (*descriptor.FileDescriptorSet, error)) (*descriptor.FileDescriptorSet, error) {
+	merged := &descriptor.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		set, err := read(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for _, f := range set.File {
+			if !seen[f.GetName()] {
+				seen[f.GetName()] = true
+				merged.File = append(merged.File, f)
+			}
+		}
+	}
+	return merged, nil
+}
+
+func parse(file string, include []string) (*descriptor.FileDescriptorSet, error) {
+	return compatibility.ReadFile(file, importPaths(file, include)...)
+}
+
+// importPaths returns the -I paths followed by the directory of file. protoc
+// names a file after the first path containing it, so a file below an -I path
+// is named as in a descriptor set built with the same -I path, and its own
+// directory is only a fallback.
+func importPaths(file string, include []string) []string {
+	return append(append([]string{}, include...), filepath.Dir(file))
+}
+
+func explain(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		for _, c := range compatibility.Conditions() {
+			fmt.Fprintf(stdout, "%-24s %s\n", c, c.Explain())
+		}
+		return exitCompatible
+	}
+	if len(args) > 1 {
+		fmt.Fprintf(stderr, "protocompat explain: expected at most one condition\n")
+		return exitUsage
+	}
+	c, ok := compatibility.ParseCondition(args[0])
+	if !ok {
+		fmt.Fprintf(stderr, "protocompat explain: unknown condition %q\n", args[0])
+		return exitUsage
+	}
+	fmt.Fprintf(stdout, "%s\n\n%s\n", c, c.Explain())
+	return exitCompatible
+}
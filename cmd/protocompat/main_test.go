@@ -0,0 +1,219 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/igfe/compatibility"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckExitCodes(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto"}, exitCompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto", "--fail-on", "warning"}, exitIncompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto", "--fail-on", "lossy"}, exitIncompatible},
+		{[]string{"check", "--new", "../../TestProtos/Proto3Protos/Changes/Original.proto", "--old", "../../TestProtos/Proto3Protos/Original.proto", "--fail-on", "lossy"}, exitCompatible},
+		{[]string{"check", "--new", "../../TestProtos/NestedProtos/NestedLabel/Changes/Original.proto", "--old", "../../TestProtos/NestedProtos/NestedLabel/Original.proto"}, exitIncompatible},
+		{[]string{"diff", "--new", "../../TestProtos/NestedProtos/NestedLabel/Changes/Original.proto", "--old", "../../TestProtos/NestedProtos/NestedLabel/Original.proto"}, exitCompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto"}, exitUsage},
+		{[]string{"check", "--new", "missing.proto", "--old", "../../TestProtos/IntProtos/Original.proto"}, exitInput},
+		{[]string{"check", "--new", "../../TestProtos/EnumPolicyProtos/Changes/Original.proto", "--old", "../../TestProtos/EnumPolicyProtos/Original.proto", "--enum-policy", "lenient"}, exitCompatible},
+		{[]string{"check", "--new", "../../TestProtos/EnumPolicyProtos/Changes/Original.proto", "--old", "../../TestProtos/EnumPolicyProtos/Original.proto"}, exitIncompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto", "--enum-policy", "loose"}, exitUsage},
+		{[]string{"check", "--new", "../../TestProtos/EnumPolicyProtos/Changes/Original.proto", "--old", "../../TestProtos/EnumPolicyProtos/Original.proto", "--mode", "backward"}, exitCompatible},
+		{[]string{"check", "--new", "../../TestProtos/EnumPolicyProtos/Changes/Original.proto", "--old", "../../TestProtos/EnumPolicyProtos/Original.proto", "--mode", "forward"}, exitIncompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto", "--mode", "sideways"}, exitUsage},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto", "--fail-on", "info"}, exitUsage},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.pb", "--fail-on", "warning"}, exitIncompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Original.json", "--old", "../../TestProtos/IntProtos/Original.pb", "--fail-on", "warning"}, exitCompatible},
+		{[]string{"check", "--new", "../../TestProtos/NestedProtos/NestedLabel/Changes/Original.proto", "--old", "../../TestProtos/NestedProtos/NestedLabel/Original.proto", "--format", "junit"}, exitIncompatible},
+		{[]string{"check", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto", "--format", "xml"}, exitUsage},
+		{[]string{"frobnicate"}, exitUsage},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(test.args, &stdout, &stderr); code != test.code {
+			t.Errorf("%v: expected exit code %d, got %d\n%s", test.args, test.code, code, stderr.String())
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"check", "--new", "../../TestProtos/NestedProtos/NestedLabel/Changes/Original.proto", "--old", "../../TestProtos/NestedProtos/NestedLabel/Original.proto", "--format", "json"}
+	if code := run(args, &stdout, &stderr); code != exitIncompatible {
+		t.Fatalf("expected exit code %d, got %d\n%s", exitIncompatible, code, stderr.String())
+	}
+	var r report
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Compatible || len(r.Differences) == 0 || r.Differences[0].Severity != compatibility.SeverityError {
+		t.Error("Unexpected report " + stdout.String())
+	}
+}
+
+func TestSARIFFormat(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"diff", "--new", "../../TestProtos/NestedProtos/NestedLabel/Changes/Original.proto", "--old", "../../TestProtos/NestedProtos/NestedLabel/Original.proto", "--format", "sarif"}
+	if code := run(args, &stdout, &stderr); code != exitCompatible {
+		t.Fatalf("expected exit code %d, got %d\n%s", exitCompatible, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"version": "2.1.0"`) || !strings.Contains(stdout.String(), `"uri": "../../TestProtos/NestedProtos/NestedLabel/Changes/Original.proto"`) {
+		t.Error("Unexpected SARIF log " + stdout.String())
+	}
+}
+
+func TestExplain(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"explain", "changedlabel"}, &stdout, &stderr); code != exitCompatible {
+		t.Fatalf("expected exit code %d, got %d", exitCompatible, code)
+	}
+	if !strings.HasPrefix(stdout.String(), "ChangedLabel\n") {
+		t.Error("Unexpected explanation " + stdout.String())
+	}
+}
+
+func TestCheckGitRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("person.proto", "message Person {\n  required int64 id = 1;\n}\n")
+	write("renamed.proto", "message Person {\n  required int64 id = 1;\n}\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "schema")
+	write("person.proto", "message Person {\n  required int64 id = 1;\n  required string email = 2;\n}\n")
+
+	person, renamed := filepath.Join(dir, "person.proto"), filepath.Join(dir, "renamed.proto")
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"check", "--new", renamed, "--git-ref", "HEAD", "--fail-on", "warning"}, exitCompatible},
+		{[]string{"check", "--new", person, "--git-ref", "HEAD"}, exitIncompatible},
+		{[]string{"check", "--new", renamed, "--old", person, "--git-ref", "HEAD"}, exitCompatible},
+		{[]string{"check", "--new", person, "--git-ref", "no-such-revision"}, exitInput},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(test.args, &stdout, &stderr); code != test.code {
+			t.Errorf("%v: expected exit code %d, got %d\n%s", test.args, test.code, code, stderr.String())
+		}
+	}
+}
+
+func TestCheckImportPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	api := filepath.Join(dir, "api")
+	if err := os.MkdirAll(filepath.Join(api, "foo", "v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	user := filepath.Join(api, "foo", "v1", "user.proto")
+	if err := ioutil.WriteFile(user, []byte("package foo.v1;\n\nmessage User {\n  required int64 id = 1;\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set := filepath.Join(dir, "user.pb")
+	if out, err := exec.Command("protoc", "-I", api, "--include_imports", "--descriptor_set_out="+set, user).CombinedOutput(); err != nil {
+		t.Fatalf("protoc: %v\n%s", err, out)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"check", "--new", user, "--old", set, "-I", api, "--fail-on", "warning"}, &stdout, &stderr); code != exitCompatible {
+		t.Errorf("Expected the .proto file to be named as in the descriptor set, got exit code %d\n%s%s", code, stdout.String(), stderr.String())
+	}
+}
+
+func TestCheckSeveralFiles(t *testing.T) {
+	args := []string{"diff", "--new", "../../TestProtos/ExtensionConflictProtos/Changes/a.proto", "--new", "../../TestProtos/ExtensionConflictProtos/Changes/b.proto", "--old", "../../TestProtos/ExtensionConflictProtos/Original.proto"}
+	var stdout, stderr bytes.Buffer
+	if code := run(args, &stdout, &stderr); code != exitCompatible {
+		t.Fatalf("Expected diff to succeed, got exit code %d\n%s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Duplicate extension number 150 in .conflict.Foo for .conflict.b.rank, already used by .conflict.a.rank") {
+		t.Error("Expected the extensions of a.proto and b.proto to be checked against each other, found\n" + stdout.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestCheckFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	unresolved := filepath.Join(dir, "unresolved.json")
+	set := `{"file": [{"name": "a.proto", "messageType": [{"name": "A", "field": [{"name": "b", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".Missing"}]}]}]}`
+	if err := ioutil.WriteFile(unresolved, []byte(set), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"diff", "--new", unresolved, "--old", unresolved}, &stdout, &stderr); code != exitFailure {
+		t.Errorf("Expected a descriptor set referring to a missing message to exit with %d, got %d\n%s", exitFailure, code, stderr.String())
+	}
+	stderr.Reset()
+	args := []string{"diff", "--new", "../../TestProtos/IntProtos/Changes/Original.proto", "--old", "../../TestProtos/IntProtos/Original.proto"}
+	if code := run(args, failingWriter{}, &stderr); code != exitFailure {
+		t.Errorf("Expected a failed write to exit with %d, got %d\n%s", exitFailure, code, stderr.String())
+	}
+}
+
+func TestFails(t *testing.T) {
+	d := compatibility.DifferenceList{Warning: []compatibility.Difference{{Condition: compatibility.MovedBetweenFiles, Severity: compatibility.SeverityInfo}}}
+	if fails(d, compatibility.SeverityWarning) {
+		t.Error("Expected a move not to fail on warnings")
+	}
+	d.Warning = append(d.Warning, compatibility.Difference{Condition: compatibility.ChangedType, Severity: compatibility.SeverityLossy})
+	if !fails(d, compatibility.SeverityWarning) || !fails(d, compatibility.SeverityLossy) || fails(d, compatibility.SeverityError) {
+		t.Error("Expected a lossy change to fail on warnings and lossy changes only")
+	}
+	d.Error = append(d.Error, compatibility.Difference{Condition: compatibility.ChangedLabel, Severity: compatibility.SeverityError})
+	if !fails(d, compatibility.SeverityError) {
+		t.Error("Expected an error to fail on errors")
+	}
+}
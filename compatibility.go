@@ -15,45 +15,18 @@
 package compatibility
 
 import (
-	"fmt"
-	"github.com/gogo/protobuf/parser"
+	"encoding/json"
+	"errors"
 	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
-	"os"
 	"strconv"
 	"strings"
 )
 
-func check(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
-
+// GetDescriptor returns the message with the given fully qualified name, as
+// used in TypeName, such as .foo.v1.User. It returns nil if there is no such
+// message.
 func GetDescriptor(path string, f *descriptor.FileDescriptorSet) *descriptor.DescriptorProto {
-	pathA := strings.Split(path, ".")
-	for _, v1 := range f.File {
-		out := getDescriptor(pathA, v1.MessageType)
-		if out != nil {
-			return out
-		}
-	}
-	return nil
-}
-
-func getDescriptor(path []string, d []*descriptor.DescriptorProto) *descriptor.DescriptorProto {
-	for _, val := range d {
-		c := 0
-		for ; path[c] == ""; c++ {
-		}
-		if val.GetName() == path[c] {
-			if len(path)-c == 1 {
-				return val
-			} else {
-				return getDescriptor(path[c+1:], val.NestedType)
-			}
-		}
-	}
-	return nil
+	return newSymbolTable(f).message(path)
 }
 
 type Condition int
@@ -68,76 +41,490 @@ const (
 	ChangedDefault          Condition = 7
 	ChangedTypeName         Condition = 8
 	NonFieldIncompatibility Condition = 9
+	ChangedSyntax           Condition = 10
+	ChangedPresence         Condition = 11
+	ChangedPacked           Condition = 12
+	RemovedService          Condition = 13
+	RemovedMethod           Condition = 14
+	ChangedMethodInputType  Condition = 15
+	ChangedMethodOutputType Condition = 16
+	ChangedStreaming        Condition = 17
+	MovedIntoOneof          Condition = 18
+	MovedOutOfOneof         Condition = 19
+	MovedBetweenOneofs      Condition = 20
+	SplitOneof              Condition = 21
+	MergedOneof             Condition = 22
+	ChangedMapKey           Condition = 23
+	ChangedMapValue         Condition = 24
+	ConvertedMap            Condition = 25
+	ChangedEnumValueNumber  Condition = 26
+	ChangedEnumValueName    Condition = 27
+	ChangedAllowAlias       Condition = 28
+	RemovedZeroValue        Condition = 29
+	ReusedReservedNumber    Condition = 30
+	ReusedReservedName      Condition = 31
+	RemovedReservedNumber   Condition = 32
+	RemovedReservedName     Condition = 33
+	MovedBetweenFiles       Condition = 34
+	RenamedMessage          Condition = 35
+	RenamedEnum             Condition = 36
+	ConvertedExtension      Condition = 37
+	ExtensionOutOfRange     Condition = 38
+	RemovedExtensionRange   Condition = 39
+	DuplicateExtension      Condition = 40
+	ReusedExtensionNumber   Condition = 41
 )
 
+var conditionNames = map[Condition]string{
+	ChangedLabel:            "ChangedLabel",
+	AddedField:              "AddedField",
+	RemovedField:            "RemovedField",
+	ChangedName:             "ChangedName",
+	ChangedType:             "ChangedType",
+	ChangedNumber:           "ChangedNumber",
+	ChangedDefault:          "ChangedDefault",
+	ChangedTypeName:         "ChangedTypeName",
+	NonFieldIncompatibility: "NonFieldIncompatibility",
+	ChangedSyntax:           "ChangedSyntax",
+	ChangedPresence:         "ChangedPresence",
+	ChangedPacked:           "ChangedPacked",
+	RemovedService:          "RemovedService",
+	RemovedMethod:           "RemovedMethod",
+	ChangedMethodInputType:  "ChangedMethodInputType",
+	ChangedMethodOutputType: "ChangedMethodOutputType",
+	ChangedStreaming:        "ChangedStreaming",
+	MovedIntoOneof:          "MovedIntoOneof",
+	MovedOutOfOneof:         "MovedOutOfOneof",
+	MovedBetweenOneofs:      "MovedBetweenOneofs",
+	SplitOneof:              "SplitOneof",
+	MergedOneof:             "MergedOneof",
+	ChangedMapKey:           "ChangedMapKey",
+	ChangedMapValue:         "ChangedMapValue",
+	ConvertedMap:            "ConvertedMap",
+	ChangedEnumValueNumber:  "ChangedEnumValueNumber",
+	ChangedEnumValueName:    "ChangedEnumValueName",
+	ChangedAllowAlias:       "ChangedAllowAlias",
+	RemovedZeroValue:        "RemovedZeroValue",
+	ReusedReservedNumber:    "ReusedReservedNumber",
+	ReusedReservedName:      "ReusedReservedName",
+	RemovedReservedNumber:   "RemovedReservedNumber",
+	RemovedReservedName:     "RemovedReservedName",
+	MovedBetweenFiles:       "MovedBetweenFiles",
+	RenamedMessage:          "RenamedMessage",
+	RenamedEnum:             "RenamedEnum",
+	ConvertedExtension:      "ConvertedExtension",
+	ExtensionOutOfRange:     "ExtensionOutOfRange",
+	RemovedExtensionRange:   "RemovedExtensionRange",
+	DuplicateExtension:      "DuplicateExtension",
+	ReusedExtensionNumber:   "ReusedExtensionNumber",
+}
+
+var conditionDescriptions = map[Condition]string{
+	ChangedLabel:            "The label of a field changed. Switching between optional and repeated is compatible, changing to or from required is not.",
+	AddedField:              "A field or enum value was added. Added fields must not be required, since old messages will not contain them. Added enum values are errors for closed enums, such as proto2 enums, and warnings for open enums unless another enum policy is chosen.",
+	RemovedField:            "A field or enum value was removed. Required fields must never be removed; optional fields may be removed as long as the number is never reused, which is best ensured by reserving it.",
+	ChangedName:             "A field kept its number but changed its name. This does not affect the binary encoding, but breaks generated code and text formats.",
+	ChangedType:             "The type of a field changed. Only types sharing the same wire type and meaning are compatible. A group and a message have different wire types, so changing between them is incompatible. Changes that may truncate values or change their sign, such as int64 to int32 or fixed32 to sfixed32, are lossy, and messages and bytes, and enums and int32, give a warning explaining when they can be read.",
+	ChangedNumber:           "A field kept its name but changed its numeric tag. Numeric tags identify fields on the wire and must never change.",
+	ChangedDefault:          "The default value of a field changed. Defaults are never sent over the wire, so each side sees its own default.",
+	ChangedTypeName:         "A message or enum field refers to a different type. Two message types are compared field by field, and their differences are listed with the paths that reach them.",
+	NonFieldIncompatibility: "A message, enum or file was added or removed.",
+	ChangedSyntax:           "A file switched between proto2 and proto3. This changes field presence, enum openness, default values and packed encoding for everything it declares.",
+	ChangedPresence:         "A proto3 field switched between implicit presence and explicit presence (optional or oneof). Implicit presence fields do not send zero values, so readers can no longer tell an unset field from a zero one.",
+	ChangedPacked:           "A repeated scalar field switched between packed and unpacked encoding. Current parsers accept both, but parsers older than protobuf 2.3 only accept the encoding they were generated with.",
+	RemovedService:          "A service was removed. Clients calling any of its methods will fail.",
+	RemovedMethod:           "A method was removed from a service. Clients calling it will fail.",
+	ChangedMethodInputType:  "The request type of a method changed. Clients keep sending the old request type and generated client code no longer compiles.",
+	ChangedMethodOutputType: "The response type of a method changed. Clients keep expecting the old response type and generated client code no longer compiles.",
+	ChangedStreaming:        "A method switched between unary and streaming for its request or response. Clients and servers disagree on the call semantics and fail.",
+	MovedIntoOneof:          "An existing field was moved into a oneof it shares with other existing fields. Old writers may set several of them, new readers only keep the last one. Moving a single field into a new oneof is safe.",
+	MovedOutOfOneof:         "A field was moved out of a oneof it shared with other existing fields. New writers may set several of them, old readers only keep the last one.",
+	MovedBetweenOneofs:      "A field was moved to a different oneof, so the fields it is mutually exclusive with changed. Whichever side treats them as a oneof only keeps the last one set.",
+	SplitOneof:              "A oneof lost some of its existing fields to other oneofs or to the message. New writers may set fields together that old readers treat as a oneof, keeping only the last one.",
+	MergedOneof:             "Existing fields were merged into a oneof. Old writers may set fields together that new readers treat as a oneof, keeping only the last one.",
+	ChangedMapKey:           "The key type of a map field changed. Only key types sharing the same wire encoding are compatible.",
+	ChangedMapValue:         "The value type of a map field changed. Only value types sharing the same wire encoding are compatible, message values are compared field by field.",
+	ConvertedMap:            "A field was converted between a map and a repeated message. This is wire compatible as long as the message has a key field 1 and a value field 2 matching the map, but breaks generated code.",
+	ChangedEnumValueNumber:  "An enum value kept its name but changed its number. Enum values are sent as numbers, so readers of the other version see a different value.",
+	ChangedEnumValueName:    "An enum number changed its name or aliases. The binary encoding is unaffected, but JSON and text format use names and generated code no longer compiles.",
+	ChangedAllowAlias:       "The allow_alias option of an enum changed. Removing it is only possible after removing all aliases, which breaks JSON and text format readers using them.",
+	RemovedZeroValue:        "The zero value of an open enum, such as a proto3 enum, was removed. Readers use it for unset fields and, in older versions, for unknown values.",
+	ReusedReservedNumber:    "A field uses a number the older version reserved. Old data may still contain the removed field under that number.",
+	ReusedReservedName:      "A field uses a name the older version reserved. JSON and text format data may still contain the removed field under that name.",
+	RemovedReservedNumber:   "Numbers were removed from the reserved numbers of a message, so the removed fields they belonged to can be reused by accident.",
+	RemovedReservedName:     "A name was removed from the reserved names of a message, so the removed field it belonged to can be reused by accident.",
+	MovedBetweenFiles:       "A message, enum or service moved to another file of its package. This does not affect the wire format, but may change imports of generated code.",
+	RenamedMessage:          "A message was renamed, as told by its fields. The binary encoding is unchanged, but Any type URLs, including the @type of JSON, and generated code use the name.",
+	RenamedEnum:             "An enum was renamed, as told by its values. The binary and JSON encodings are unchanged, but generated code uses the name.",
+	ConvertedExtension:      "A field was converted to an extension with the same number, or an extension to a field. This is wire compatible as long as the field is not required and its type stays the same, but generated code, JSON and text format access extensions differently.",
+	ExtensionOutOfRange:     "An extension uses a number outside of the extension ranges of the message it extends, which protoc rejects.",
+	RemovedExtensionRange:   "Numbers were removed from the extension ranges of a message, so extensions using them no longer compile. This gives an error if an extension of the older version uses them, and a warning otherwise, since extensions may be declared in other files.",
+	DuplicateExtension:      "Two extensions of the same message use the same number. Files declaring them compile separately, but registering both fails at runtime. It is only found when both files are compared at once, by repeating --new or merging their sets.",
+	ReusedExtensionNumber:   "A new extension uses a number that another extension or field of the message used in the older version, so old data is read as the new extension.",
+}
+
+func (c Condition) String() string {
+	if name, ok := conditionNames[c]; ok {
+		return name
+	}
+	return "Condition(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Explain returns a description of the compatibility rule behind a condition.
+func (c Condition) Explain() string {
+	return conditionDescriptions[c]
+}
+
+// ParseCondition returns the condition with the given name, as returned by String.
+func ParseCondition(name string) (Condition, bool) {
+	for c, n := range conditionNames {
+		if strings.EqualFold(n, name) {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// RuleID returns the stable identifier of the rule behind a condition, such
+// as PC001 for ChangedLabel.
+func (c Condition) RuleID() string {
+	id := strconv.Itoa(int(c))
+	for len(id) < 3 {
+		id = "0" + id
+	}
+	return "PC" + id
+}
+
+// MarshalText encodes a condition as its name.
+func (c Condition) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a condition from its name.
+func (c *Condition) UnmarshalText(text []byte) error {
+	parsed, ok := ParseCondition(string(text))
+	if !ok {
+		return errors.New("unknown condition " + strconv.Quote(string(text)))
+	}
+	*c = parsed
+	return nil
+}
+
+// Conditions returns all known conditions in ascending order.
+func Conditions() []Condition {
+	var out []Condition
+	for c := ChangedLabel; conditionNames[c] != ""; c++ {
+		out = append(out, c)
+	}
+	return out
+}
+
+// Severity tells whether a difference breaks compatibility. Severities are
+// ordered by seriousness, so they can be compared with each other.
+type Severity int
+
+const (
+	// SeverityInfo marks a difference that does not affect compatibility at
+	// all, such as a message moved to another file. Informational differences
+	// are listed among the warnings, but never fail a check.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks a difference that is compatible on the wire, but
+	// may still affect some readers or generated code.
+	SeverityWarning
+	// SeverityLossy marks a type change readers of either version can parse,
+	// but which may truncate values or change their sign. Lossy differences
+	// are listed among the warnings.
+	SeverityLossy
+	// SeverityError marks a difference that breaks compatibility.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	if s == SeverityLossy {
+		return "lossy"
+	}
+	if s == SeverityInfo {
+		return "info"
+	}
+	return "warning"
+}
+
+// MarshalText encodes a severity as "error", "lossy", "warning" or "info".
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity encoded by MarshalText.
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "error":
+		*s = SeverityError
+	case "lossy":
+		*s = SeverityLossy
+	case "warning":
+		*s = SeverityWarning
+	case "info":
+		*s = SeverityInfo
+	default:
+		return errors.New("unknown severity " + strconv.Quote(string(text)))
+	}
+	return nil
+}
+
+// Difference is a single change found between two versions of a schema.
 type Difference struct {
-	condition Condition
-	newValue  string
-	oldValue  string
-	path      string
-	qualifier string
-	message   string
+	Condition Condition `json:"condition"`
+	Severity  Severity  `json:"severity"`
+	// RuleID is the stable identifier of the rule behind Condition.
+	RuleID string `json:"rule_id"`
+	// File is the file the difference was found in, which is the older file
+	// for removed files and the newer file otherwise.
+	File string `json:"file,omitempty"`
+	// Path is the fully qualified element containing the change, such as a
+	// message, enum or service, and Qualifier the field number, value or
+	// method within it.
+	Path      string `json:"path"`
+	Qualifier string `json:"qualifier,omitempty"`
+	NewValue  string `json:"new_value,omitempty"`
+	OldValue  string `json:"old_value,omitempty"`
+	// Message holds additional details, which String appends to its description.
+	Message string `json:"message,omitempty"`
+	// NewLocation and OldLocation point to the element in the newer and
+	// older .proto file, if they were parsed with source code info.
+	NewLocation *Location `json:"new_location,omitempty"`
+	OldLocation *Location `json:"old_location,omitempty"`
+	// Via lists the fields through which a message was reached whose
+	// differences are reported once for all fields changing to its type.
+	Via []string `json:"via,omitempty"`
+	// Breaks tells in which modes an error breaks compatibility. It is kept
+	// when an error is reported as a warning because it does not break the
+	// mode of the Comparer.
+	Breaks Mode `json:"breaks,omitempty"`
 }
 
+// MarshalJSON encodes a difference along with its description as returned by String.
+func (d Difference) MarshalJSON() ([]byte, error) {
+	type difference Difference
+	return json.Marshal(struct {
+		difference
+		Text string `json:"text"`
+	}{difference(d), d.String()})
+}
+
+// String describes the difference, prefixed by its location if it is known.
 func (d *Difference) String() string {
+	switch {
+	case d.NewLocation != nil && d.OldLocation != nil && *d.NewLocation != *d.OldLocation:
+		return d.NewLocation.String() + ": " + d.text() + " (previously " + d.OldLocation.String() + ")"
+	case d.NewLocation != nil:
+		return d.NewLocation.String() + ": " + d.text()
+	case d.OldLocation != nil:
+		return d.OldLocation.String() + ": " + d.text()
+	}
+	return d.text()
+}
+
+func (d *Difference) text() string {
+	if len(d.Via) > 0 {
+		return d.describe() + " (via " + strings.Join(d.Via, ", ") + ")"
+	}
+	return d.describe()
+}
+
+func (d *Difference) describe() string {
 	path := ""
-	if d.path == "" {
+	if d.Path == "" {
 		path = "."
 	} else {
-		path = d.path
-	}
-	if d.condition == ChangedLabel {
-		return "Changed label of field nr " + d.qualifier + " in " + path + " from " + d.oldValue + " to " + d.newValue
-	} else if d.condition == AddedField {
-		return "Added Field nr " + d.qualifier + " in " + path + " of label " + d.newValue + d.message
-	} else if d.condition == RemovedField {
-		return "Removed Field nr " + d.qualifier + " in " + path + " of label " + d.newValue + d.message
-	} else if d.condition == ChangedName {
-		return "Changed name of field nr " + d.qualifier + " in " + path + " from " + d.oldValue + " to " + d.newValue
-	} else if d.condition == ChangedType {
-		return "Changed type of field nr " + d.qualifier + " in " + path + " from " + d.oldValue + " to " + d.newValue
-	} else if d.condition == ChangedNumber {
-		return "Changed numeric tag of field named \"" + d.qualifier + "\" in " + path + " from " + d.oldValue + " to " + d.newValue
-	} else if d.condition == ChangedDefault {
-		return "Changed default value of field nr " + d.qualifier + " in " + path + " from " + d.oldValue + " to " + d.newValue + " this is generally OK"
-	} else if d.condition == NonFieldIncompatibility {
-		return d.message
-	} else if d.condition == ChangedTypeName {
-		return "Changed TypeName of field " + d.qualifier + " from " + d.oldValue + " to " + d.newValue + " in " + path + " manually compare message types using compare message method"
+		path = d.Path
+	}
+	if d.Condition == ChangedLabel {
+		return "Changed label of field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == AddedField {
+		return "Added Field nr " + d.Qualifier + " in " + path + " of label " + d.NewValue + d.Message
+	} else if d.Condition == RemovedField {
+		return "Removed Field nr " + d.Qualifier + " in " + path + " of label " + d.NewValue + d.Message
+	} else if d.Condition == ChangedName {
+		return "Changed name of field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ChangedType {
+		return "Changed type of field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == ChangedNumber {
+		return "Changed numeric tag of field named \"" + d.Qualifier + "\" in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ChangedDefault {
+		return "Changed default value of field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue + " this is generally OK" + d.Message
+	} else if d.Condition == NonFieldIncompatibility {
+		return d.Message
+	} else if d.Condition == ChangedTypeName {
+		return "Changed TypeName of field " + d.Qualifier + " from " + d.OldValue + " to " + d.NewValue + " in " + path + d.Message
+	} else if d.Condition == ChangedSyntax {
+		return "Changed syntax of " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ChangedPresence {
+		return "Changed presence of field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == ChangedPacked {
+		return "Changed encoding of field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == RemovedService {
+		return "Removed service " + d.Qualifier + " in " + path
+	} else if d.Condition == RemovedMethod {
+		return "Removed method " + d.Qualifier + " in " + path
+	} else if d.Condition == ChangedMethodInputType {
+		return "Changed input type of method " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ChangedMethodOutputType {
+		return "Changed output type of method " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ChangedStreaming {
+		return "Changed streaming of method " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == MovedIntoOneof {
+		return "Moved field nr " + d.Qualifier + " in " + path + " into oneof " + d.NewValue + d.Message
+	} else if d.Condition == MovedOutOfOneof {
+		return "Moved field nr " + d.Qualifier + " in " + path + " out of oneof " + d.OldValue + d.Message
+	} else if d.Condition == MovedBetweenOneofs {
+		return "Moved field nr " + d.Qualifier + " in " + path + " from oneof " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == SplitOneof {
+		return "Split oneof " + d.NewValue + " of field nr " + d.Qualifier + " in " + path + d.Message
+	} else if d.Condition == MergedOneof {
+		return "Merged fields into oneof " + d.NewValue + " of field nr " + d.Qualifier + " in " + path + d.Message
+	} else if d.Condition == ChangedMapKey {
+		return "Changed type of map key " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == ChangedMapValue {
+		return "Changed type of map value " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == ConvertedMap {
+		return "Converted field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == ChangedEnumValueNumber {
+		return "Changed number of enum value " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ChangedEnumValueName {
+		return "Changed name of enum value nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue + d.Message
+	} else if d.Condition == ChangedAllowAlias {
+		return "Changed allow_alias of " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == RemovedZeroValue {
+		return "Removed zero value " + d.NewValue + " in " + path + d.Message
+	} else if d.Condition == ReusedReservedNumber {
+		return "Reused reserved number " + d.Qualifier + " in " + path + " for field " + d.NewValue
+	} else if d.Condition == ReusedReservedName {
+		return "Reused reserved name " + d.Qualifier + " in " + path + " for field nr " + d.NewValue
+	} else if d.Condition == RemovedReservedNumber {
+		return "Removed reserved numbers " + d.OldValue + " in " + path
+	} else if d.Condition == RemovedReservedName {
+		return "Removed reserved name " + d.OldValue + " in " + path
+	} else if d.Condition == MovedBetweenFiles {
+		return "Moved " + d.Qualifier + " " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == RenamedMessage {
+		return "Renamed message " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == RenamedEnum {
+		return "Renamed enum " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ConvertedExtension {
+		return "Converted field nr " + d.Qualifier + " in " + path + " from " + d.OldValue + " to " + d.NewValue
+	} else if d.Condition == ExtensionOutOfRange {
+		return "Extension " + d.NewValue + " of " + path + " uses number " + d.Qualifier + " outside of its extension ranges"
+	} else if d.Condition == RemovedExtensionRange {
+		return "Removed extension numbers " + d.OldValue + " in " + path + d.Message
+	} else if d.Condition == DuplicateExtension {
+		name := d.NewValue
+		if name == "" { //found in the older version
+			name = d.OldValue
+		}
+		return "Duplicate extension number " + d.Qualifier + " in " + path + " for " + name + d.Message
+	} else if d.Condition == ReusedExtensionNumber {
+		return "Reused number " + d.Qualifier + " in " + path + " for extension " + d.NewValue + ", previously used by " + d.OldValue
 	}
 	return ""
 }
 
+// Element is a message, enum or service found in both versions.
+type Element struct {
+	Kind string // "message", "enum" or "service"
+	File string
+	Path string
+}
+
 type DifferenceList struct {
-	Error     []Difference
-	Warning   []Difference
-	Extension []Difference
+	Error   []Difference `json:"errors"`
+	Warning []Difference `json:"warnings"`
+	// Extension repeats the errors and warnings concerning extensions, such
+	// as fields converted to extensions and removed extension ranges.
+	Extension []Difference `json:"extensions,omitempty"`
+	// Compared lists the elements that were compared, whether or not they changed.
+	Compared []Element `json:"-"`
+}
+
+func (d *DifferenceList) addWarning(c Condition, newValue, oldValue, path, qualifier, message string) *Difference {
+	d1 := Difference{Condition: c, Severity: SeverityWarning, RuleID: c.RuleID(), Path: path, Qualifier: qualifier, NewValue: newValue, OldValue: oldValue, Message: message}
+	d.Warning = append(d.Warning, d1)
+	return &d.Warning[len(d.Warning)-1]
 }
 
-func (d *DifferenceList) addWarning(c Condition, newValue, oldValue, path, qualifier, message string) {
-	d1 := Difference{c, newValue, oldValue, path, qualifier, message}
+func (d *DifferenceList) addLossy(c Condition, newValue, oldValue, path, qualifier, message string) *Difference {
+	d1 := Difference{Condition: c, Severity: SeverityLossy, RuleID: c.RuleID(), Path: path, Qualifier: qualifier, NewValue: newValue, OldValue: oldValue, Message: message}
 	d.Warning = append(d.Warning, d1)
+	return &d.Warning[len(d.Warning)-1]
 }
 
-func (d *DifferenceList) addError(c Condition, newValue, oldValue, path, qualifier, message string) {
-	d1 := Difference{c, newValue, oldValue, path, qualifier, message}
+func (d *DifferenceList) addInfo(c Condition, newValue, oldValue, path, qualifier, message string) *Difference {
+	d1 := Difference{Condition: c, Severity: SeverityInfo, RuleID: c.RuleID(), Path: path, Qualifier: qualifier, NewValue: newValue, OldValue: oldValue, Message: message}
+	d.Warning = append(d.Warning, d1)
+	return &d.Warning[len(d.Warning)-1]
+}
+
+func (d *DifferenceList) addError(c Condition, newValue, oldValue, path, qualifier, message string) *Difference {
+	d1 := Difference{Condition: c, Severity: SeverityError, RuleID: c.RuleID(), Breaks: ModeFull, Path: path, Qualifier: qualifier, NewValue: newValue, OldValue: oldValue, Message: message}
 	d.Error = append(d.Error, d1)
+	return &d.Error[len(d.Error)-1]
+}
+
+func (d *DifferenceList) addCompared(kind, path string) {
+	d.Compared = append(d.Compared, Element{Kind: kind, Path: path})
+}
+
+// inFile sets the file of every difference and element that does not have one yet.
+func (d *DifferenceList) inFile(name string) {
+	for _, list := range [][]Difference{d.Error, d.Warning, d.Extension} {
+		for i := range list {
+			if list[i].File == "" {
+				list[i].File = name
+			}
+		}
+	}
+	for i := range d.Compared {
+		if d.Compared[i].File == "" {
+			d.Compared[i].File = name
+		}
+	}
 }
 
 func (d1 *DifferenceList) merge(d2 DifferenceList) {
 	d1.Error = append(d1.Error, d2.Error...)
 	d1.Warning = append(d1.Warning, d2.Warning...)
-}
-
-func (d1 *DifferenceList) mergeExt(d2 DifferenceList) {
-	d1.Extension = append(d1.Extension, d2.Error...)
+	d1.Compared = append(d1.Compared, d2.Compared...)
 }
 
 func (d *DifferenceList) String(suppressWarning bool) string {
 	var output string = ""
-	if !suppressWarning && d.Warning != nil {
+	var info, warnings, lossy []Difference
+	for _, val := range d.Warning {
+		if val.Severity == SeverityLossy {
+			lossy = append(lossy, val)
+		} else if val.Severity == SeverityInfo {
+			info = append(info, val)
+		} else {
+			warnings = append(warnings, val)
+		}
+	}
+	if !suppressWarning && info != nil {
+		output = output + "INFO\n"
+		for _, val := range info {
+			output = output + val.String() + "\n"
+		}
+	}
+	if !suppressWarning && warnings != nil {
 		output = output + "WARNING\n"
-		for _, val := range d.Warning {
+		for _, val := range warnings {
+			output = output + val.String() + "\n"
+		}
+	}
+	if lossy != nil { //lossy changes are shown even without warnings
+		output = output + "LOSSY\n"
+		for _, val := range lossy {
 			output = output + val.String() + "\n"
 		}
 	}
@@ -157,87 +544,189 @@ func (d *DifferenceList) IsCompatible() bool {
 	return false
 }
 
+// EnumPolicy decides how values added to an enum are reported.
+type EnumPolicy int
+
+const (
+	// EnumPolicyOpenness reports added values as warnings for open enums,
+	// whose old readers keep unknown values, and as errors for closed enums,
+	// whose old readers treat them as unknown fields.
+	EnumPolicyOpenness EnumPolicy = iota
+	// EnumPolicyStrict reports every added value as an error.
+	EnumPolicyStrict
+	// EnumPolicyLenient reports every added value as a warning.
+	EnumPolicyLenient
+)
+
 type Comparer struct {
 	Newer *descriptor.FileDescriptorSet
 	Older *descriptor.FileDescriptorSet
-}
 
-func (c *Comparer) appendExtensions() {
-	for _, val := range c.Newer.File {
-		for _, ext := range val.Extension {
-			d := GetDescriptor(*ext.Extendee, c.Newer)
-			d.Field = append(d.Field, ext)
-		}
-		for _, message := range val.MessageType {
-			apndext(message, c.Newer)
-		}
-	}
-	for _, val := range c.Older.File {
-		for _, ext := range val.Extension {
-			if ext != nil {
-				d := GetDescriptor(*ext.Extendee, c.Older)
-				d.Field = append(d.Field, ext)
-			}
-		}
-		for _, message := range val.MessageType {
-			apndext(message, c.Older)
-		}
-	}
+	EnumPolicy EnumPolicy
+	// RequireReserved reports fields removed without reserving both their
+	// number and name as errors instead of warnings. A name still used by
+	// another field needs no reservation.
+	RequireReserved bool
+	// Mode is the direction in which the versions must stay compatible.
+	// Errors only breaking the other direction are reported as warnings.
+	Mode Mode
+
+	files     map[interface{}]*descriptor.FileDescriptorProto // declaring file of every message, enum and field
+	newer     *symbolTable                                    // symbols of Newer by fully qualified name
+	older     *symbolTable                                    // symbols of Older by fully qualified name
+	locations map[interface{}]*Location                       // source location of every element, if known
+	pairs     *typePairs                                      // messages reached through fields whose type changed
+	renamed   map[interface{}]interface{}                     // counterpart of every renamed top-level message and enum
 }
 
-func apndext(d *descriptor.DescriptorProto, c *descriptor.FileDescriptorSet) {
-	for _, ext := range d.Extension {
-		d := GetDescriptor(*ext.Extendee, c)
-		d.Field = append(d.Field, ext)
+// Compare reports the differences between the older and the newer version. It
+// returns a MalformedDescriptorError or an UnresolvedTypeError if either
+// version cannot be compared. Compare indexes the versions on a copy of c and
+// never changes them, so a Comparer can be used again and a set can be shared
+// between Comparers running concurrently.
+func (c Comparer) Compare() (DifferenceList, error) {
+	var err error
+	if c.newer, err = validate(c.Newer); err != nil {
+		return DifferenceList{}, err
 	}
-	for _, msg := range d.NestedType {
-		apndext(msg, c)
+	if c.older, err = validate(c.Older); err != nil {
+		return DifferenceList{}, err
 	}
-}
-
-func (c *Comparer) Compare() DifferenceList {
-	c.appendExtensions()
+	c.files = indexFiles(c.Newer, c.Older)
+	c.locations = indexLocations(c.Newer, c.Older)
+	c.pairs = newTypePairs()
 	var output DifferenceList
-	for _, val1 := range c.Newer.File { //loop through both arrays to see which fields existed in the older version too and which were newly added
+	c.renamed = topLevelRenames(c)
+	for _, val1 := range c.Newer.File { //files are matched by name, their contents by fully qualified name below
+		var file DifferenceList
 		exist := false
 		for _, val2 := range c.Older.File {
-			if val1.GetPackage() == val2.GetPackage() {
+			if val1.GetName() == val2.GetName() {
 				exist = true
-				output.merge(getChangesDP(val1.MessageType, val2.MessageType, "", *c)) //if proto exists in both files, compare it
+				if syntax(val1) != syntax(val2) {
+					file.addWarning(ChangedSyntax, syntax(val1), syntax(val2), val1.GetName(), "", "").at(c, val1, val2)
+				}
 			}
 		}
 		if !exist {
-			output.addWarning(NonFieldIncompatibility, "", "", "", "", "Added proto file "+strings.Split(val1.GetName(), ".")[0])
+			file.addWarning(NonFieldIncompatibility, "", "", val1.GetName(), strings.Split(val1.GetName(), ".")[0], "Added proto file "+strings.Split(val1.GetName(), ".")[0]).at(c, val1, nil)
 		}
+		file.merge(getChangesSymbols(val1, c))
+		file.inFile(val1.GetName())
+		output.merge(file)
 	}
 	for _, val1 := range c.Older.File {
+		var file DifferenceList
 		exist := false
 		for _, val2 := range c.Newer.File {
-			if val1.GetPackage() == val2.GetPackage() {
+			if val1.GetName() == val2.GetName() {
 				exist = true
 			}
 		}
 		if !exist {
-			output.addWarning(NonFieldIncompatibility, "", "", "", "", "Removed proto file "+strings.Split(val1.GetName(), ".")[0]) //if it exists only in the old proto, it has been removed
+			file.addWarning(NonFieldIncompatibility, "", "", val1.GetName(), strings.Split(val1.GetName(), ".")[0], "Removed proto file "+strings.Split(val1.GetName(), ".")[0]).at(c, nil, val1) //if it exists only in the old proto, it has been removed
+		}
+		scope := packageScope(val1)
+		for _, val2 := range val1.MessageType {
+			if c.newer.messages[scope+"."+val2.GetName()] == nil && c.renamed[val2] == nil {
+				file.merge(getChangesDP(nil, []*descriptor.DescriptorProto{val2}, scope, c))
+			}
+		}
+		for _, val2 := range val1.EnumType {
+			if c.newer.enums[scope+"."+val2.GetName()] == nil && c.renamed[val2] == nil {
+				file.merge(getChangesEDP(nil, []*descriptor.EnumDescriptorProto{val2}, scope, c))
+			}
+		}
+		for _, val2 := range val1.Service {
+			if c.newer.services[scope+"."+val2.GetName()] == nil {
+				file.merge(getChangesSDP(nil, []*descriptor.ServiceDescriptorProto{val2}, scope, c))
+			}
+		}
+		file.inFile(val1.GetName())
+		output.merge(file)
+	}
+	output.merge(compareTypePairs(c))
+	output.merge(duplicateExtensions(c))
+	output.inMode(c.Mode)
+	output.listExtensions()
+	return output, nil
+}
+
+// getChangesSymbols compares the messages, enums and services declared at
+// the top level of a newer file with the older ones of the same fully
+// qualified name, wherever they are declared, and reports the ones that
+// moved to another file or were renamed. Paths start with the package of the
+// file, like the names protoc writes into TypeName.
+func getChangesSymbols(file *descriptor.FileDescriptorProto, c Comparer) DifferenceList {
+	var output DifferenceList
+	scope := packageScope(file)
+	moved := func(kind, name string, val1, val2 interface{}) {
+		if from := c.files[val2].GetName(); from != file.GetName() {
+			output.addInfo(MovedBetweenFiles, file.GetName(), from, scope+"."+name, kind, "").at(c, val1, val2)
+		}
+	}
+	for _, val1 := range file.MessageType {
+		val2 := c.older.messages[scope+"."+val1.GetName()]
+		if val2 == nil {
+			if old, ok := c.renamed[val1].(*descriptor.DescriptorProto); ok {
+				output.merge(compareRenamedMessages(val1, old, scope, c))
+			} else {
+				output.merge(getChangesDP([]*descriptor.DescriptorProto{val1}, nil, scope, c))
+			}
+			continue
+		}
+		moved("message", val1.GetName(), val1, val2)
+		output.merge(getChangesDP([]*descriptor.DescriptorProto{val1}, []*descriptor.DescriptorProto{val2}, scope, c))
+	}
+	for _, val1 := range file.EnumType {
+		val2 := c.older.enums[scope+"."+val1.GetName()]
+		if val2 == nil {
+			if old, ok := c.renamed[val1].(*descriptor.EnumDescriptorProto); ok {
+				output.merge(compareRenamedEnums(val1, old, scope, c))
+			} else {
+				output.merge(getChangesEDP([]*descriptor.EnumDescriptorProto{val1}, nil, scope, c))
+			}
+			continue
+		}
+		moved("enum", val1.GetName(), val1, val2)
+		output.merge(getChangesEDP([]*descriptor.EnumDescriptorProto{val1}, []*descriptor.EnumDescriptorProto{val2}, scope, c))
+	}
+	for _, val1 := range file.Service {
+		val2 := c.older.services[scope+"."+val1.GetName()]
+		if val2 == nil {
+			output.merge(getChangesSDP([]*descriptor.ServiceDescriptorProto{val1}, nil, scope, c))
+			continue
 		}
+		moved("service", val1.GetName(), val1, val2)
+		output.merge(getChangesSDP([]*descriptor.ServiceDescriptorProto{val1}, []*descriptor.ServiceDescriptorProto{val2}, scope, c))
 	}
 	return output
 }
 
+// packageScope returns the prefix of fully qualified names declared in a file.
+func packageScope(file *descriptor.FileDescriptorProto) string {
+	if file.GetPackage() == "" {
+		return ""
+	}
+	return "." + file.GetPackage()
+}
+
 func getChangesDP(newer, older []*descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
 	var output DifferenceList
+	var added, removed []*descriptor.DescriptorProto
 	for _, val1 := range newer {
 		exist := false
 		for _, val2 := range older {
 			if val1.GetName() == val2.GetName() {
 				exist = true
-				output.merge(getChangesFieldDP(val1.Field, val2.Field, val1.ExtensionRange, val2.ExtensionRange, path+"."+val1.GetName(), c))
-				output.merge(getChangesDP(val1.NestedType, val2.NestedType, path+"."+val1.GetName(), c))
-				output.merge(getChangesEDP(val1.EnumType, val2.EnumType, path+"."+val1.GetName()))
+				if !isMapEntry(val1) && !isMapEntry(val2) { //map entries are compared through their map fields
+					output.addCompared("message", path+"."+val1.GetName())
+					output.merge(compareMessages(val1, val2, path+"."+val1.GetName(), c))
+				}
 			}
 		}
-		if !exist {
-			output.addWarning(NonFieldIncompatibility, "", "", "", "", "Added message "+val1.GetName()+" in "+path)
+		if !exist && !isMapEntry(val1) {
+			added = append(added, val1)
 		}
 	}
 	for _, val1 := range older {
@@ -247,25 +736,58 @@ func getChangesDP(newer, older []*descriptor.DescriptorProto, path string, c Com
 				exist = true
 			}
 		}
-		if !exist {
-			output.addWarning(NonFieldIncompatibility, "", "", "", "", "Removed message "+val1.GetName()+" in "+path)
+		if !exist && !isMapEntry(val1) {
+			removed = append(removed, val1)
+		}
+	}
+	renamed := renamedMessages(added, removed)
+	for _, val1 := range added {
+		if val2, ok := renamed[val1]; ok {
+			output.merge(compareRenamedMessages(val1, val2, path, c))
+		} else {
+			output.addWarning(NonFieldIncompatibility, "", "", path+"."+val1.GetName(), val1.GetName(), "Added message "+val1.GetName()+" in "+path).at(c, val1, nil)
+		}
+	}
+	for _, val1 := range removed {
+		found := false
+		for _, val2 := range renamed {
+			if val1 == val2 {
+				found = true
+			}
+		}
+		if !found {
+			output.addWarning(NonFieldIncompatibility, "", "", path+"."+val1.GetName(), val1.GetName(), "Removed message "+val1.GetName()+" in "+path).at(c, nil, val1)
 		}
 	}
 	return output
 }
 
-func getChangesEDP(newer, older []*descriptor.EnumDescriptorProto, path string) DifferenceList {
+func compareMessages(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
 	var output DifferenceList
+	output.merge(getChangesFieldDP(newer, older, path, c))
+	output.merge(getChangesReserved(newer, older, path, c))
+	output.merge(getChangesExtensionRanges(newer, older, path, c))
+	output.merge(getChangesExtensionNumbers(newer, older, path, c))
+	output.merge(getChangesOneofs(newer, older, path, c))
+	output.merge(getChangesDP(newer.NestedType, older.NestedType, path, c))
+	output.merge(getChangesEDP(newer.EnumType, older.EnumType, path, c))
+	return output.at(c, newer, older)
+}
+
+func getChangesEDP(newer, older []*descriptor.EnumDescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	var added, removed []*descriptor.EnumDescriptorProto
 	for _, val1 := range newer {
 		exist := false
 		for _, val2 := range older {
 			if val1.GetName() == val2.GetName() {
 				exist = true
-				output.merge(getChangesEVDP(val1.Value, val2.Value, path+"."+val1.GetName()))
+				output.addCompared("enum", path+"."+val1.GetName())
+				output.merge(compareEnums(val1, val2, path+"."+val1.GetName(), c))
 			}
 		}
 		if !exist {
-			output.addWarning(NonFieldIncompatibility, "", "", "", "", "Added enum "+val1.GetName()+" in "+path)
+			added = append(added, val1)
 		}
 	}
 	for _, val1 := range older {
@@ -276,48 +798,90 @@ func getChangesEDP(newer, older []*descriptor.EnumDescriptorProto, path string)
 			}
 		}
 		if !exist {
-			output.addWarning(NonFieldIncompatibility, "", "", "", "", "Removed enum "+val1.GetName()+" in "+path)
+			removed = append(removed, val1)
+		}
+	}
+	renamed := renamedEnums(added, removed)
+	for _, val1 := range added {
+		if val2, ok := renamed[val1]; ok {
+			output.merge(compareRenamedEnums(val1, val2, path, c))
+		} else {
+			output.addWarning(NonFieldIncompatibility, "", "", path+"."+val1.GetName(), val1.GetName(), "Added enum "+val1.GetName()+" in "+path).at(c, val1, nil)
+		}
+	}
+	for _, val1 := range removed {
+		found := false
+		for _, val2 := range renamed {
+			if val1 == val2 {
+				found = true
+			}
+		}
+		if !found {
+			output.addWarning(NonFieldIncompatibility, "", "", path+"."+val1.GetName(), val1.GetName(), "Removed enum "+val1.GetName()+" in "+path).at(c, nil, val1)
 		}
 	}
 	return output
 }
 
-func getChangesFieldDP(newer, older []*descriptor.FieldDescriptorProto, newEx, oldEx []*descriptor.DescriptorProto_ExtensionRange, path string, c Comparer) DifferenceList {
+func compareEnums(newer, older *descriptor.EnumDescriptorProto, path string, c Comparer) DifferenceList {
 	var output DifferenceList
-	for _, val1 := range newer { //loop through both arrays to see which fields existed in the older version too and which were newly added
+	if newer.GetOptions().GetAllowAlias() != older.GetOptions().GetAllowAlias() {
+		output.addWarning(ChangedAllowAlias, strconv.FormatBool(newer.GetOptions().GetAllowAlias()), strconv.FormatBool(older.GetOptions().GetAllowAlias()), path, "", "").at(c, newer, older)
+	}
+	output.merge(getChangesEVDP(newer.Value, older.Value, path, isOpenEnum(older, c.files[older]), c))
+	return output
+}
+
+func getChangesFieldDP(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	//extensions are compared like the fields of their extendee
+	newFields, oldFields := c.newer.fields(newer), c.older.fields(older)
+	for _, val1 := range newFields { //loop through both arrays to see which fields existed in the older version too and which were newly added
 		exist := false
-		for _, val2 := range older {
+		for _, val2 := range oldFields {
 			if val1.GetNumber() == val2.GetNumber() { //if message exists in both, check label, numeric tag and type for dissimilarities
 				exist = true
-				output.merge(compareFields(*val1, *val2, path, c))
+				output.merge(compareFields(val1, val2, path, c))
+				output.merge(compareConversion(val1, val2, path, c))
 			}
 		}
 		if !exist {
 			if val1.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REQUIRED {
-				output.addError(AddedField, val1.Label.String(), "", path, strconv.Itoa(int(*val1.Number)), "")
+				output.addError(AddedField, val1.Label.String(), "", path, strconv.Itoa(int(val1.GetNumber())), "").breaks(ModeBackward).at(c, val1, nil) //old data lacks it
 			}
 		}
 	}
-	for _, val1 := range older {
+	for _, val1 := range oldFields {
 		exist := false
-		for _, val2 := range newer {
+		for _, val2 := range newFields {
 			if val1.GetNumber() == val2.GetNumber() {
 				exist = true
 			}
 		}
 		if !exist {
+			kept := isReservedName(val1.GetName(), newer) //the name is reserved or still used by another field
+			for _, val2 := range newFields {
+				if val1.GetName() == val2.GetName() {
+					kept = true
+				}
+			}
 			if val1.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REQUIRED {
-				output.addError(RemovedField, val1.Label.String(), "", path, strconv.Itoa(int(*val1.Number)), "")
+				output.addError(RemovedField, val1.Label.String(), "", path, strconv.Itoa(int(val1.GetNumber())), "").breaks(ModeForward).at(c, nil, val1) //old readers require it
+			} else if c.RequireReserved && !isReservedNumber(val1.GetNumber(), newer) {
+				output.addError(RemovedField, val1.Label.String(), "", path, strconv.Itoa(int(val1.GetNumber())), " without reserving its number").at(c, nil, val1)
+			} else if c.RequireReserved && !kept {
+				output.addError(RemovedField, val1.Label.String(), "", path, strconv.Itoa(int(val1.GetNumber())), " without reserving its name "+val1.GetName()).at(c, nil, val1)
+			} else if isReservedNumber(val1.GetNumber(), newer) { //the number can never be reused, nothing to report
 			} else {
-				output.addWarning(RemovedField, val1.Label.String(), "", path, strconv.Itoa(int(*val1.Number)), " consider pathing \"OBSOLETE_\" instead")
+				output.addWarning(RemovedField, val1.Label.String(), "", path, strconv.Itoa(int(val1.GetNumber())), " consider reserving its number and name, or prefixing it with \"OBSOLETE_\" instead").at(c, nil, val1)
 			}
 		}
 	}
-	for _, val1 := range newer {
-		for _, val2 := range older {
+	for _, val1 := range newFields {
+		for _, val2 := range oldFields {
 			if val1.GetName() == val2.GetName() {
 				if val1.GetNumber() != val2.GetNumber() {
-					output.addWarning(ChangedNumber, strconv.Itoa(int(*val1.Number)), strconv.Itoa(int(*val2.Number)), path, val1.GetName(), "")
+					output.addWarning(ChangedNumber, strconv.Itoa(int(val1.GetNumber())), strconv.Itoa(int(val2.GetNumber())), path, val1.GetName(), "").at(c, val1, val2)
 				}
 			}
 		}
@@ -325,136 +889,160 @@ func getChangesFieldDP(newer, older []*descriptor.FieldDescriptorProto, newEx, o
 	return output
 }
 
-func compareFields(val1, val2 descriptor.FieldDescriptorProto, path string, c Comparer) DifferenceList {
+func compareFields(val1, val2 *descriptor.FieldDescriptorProto, path string, c Comparer) DifferenceList {
 	var output DifferenceList
 	if val1.Label.String() != val2.Label.String() { //If field label changed add it to differences
 		if val1.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REQUIRED {
-			output.addError(ChangedLabel, val1.Label.String(), val2.Label.String(), path, strconv.Itoa(int(*val1.Number)), "")
+			output.addError(ChangedLabel, val1.Label.String(), val2.Label.String(), path, strconv.Itoa(int(val1.GetNumber())), "").breaks(ModeBackward)
 		} else if val2.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REQUIRED {
-			output.addError(ChangedLabel, val1.Label.String(), val2.Label.String(), path, strconv.Itoa(int(*val1.Number)), "")
+			output.addError(ChangedLabel, val1.Label.String(), val2.Label.String(), path, strconv.Itoa(int(val1.GetNumber())), "").breaks(ModeForward)
 		} else {
-			output.addWarning(ChangedLabel, val1.Label.String(), val2.Label.String(), path, strconv.Itoa(int(*val1.Number)), "")
+			output.addWarning(ChangedLabel, val1.Label.String(), val2.Label.String(), path, strconv.Itoa(int(val1.GetNumber())), "")
 		}
 	}
 	if val1.GetName() != val2.GetName() {
-		output.addWarning(ChangedName, val1.GetName(), val2.GetName(), path, strconv.Itoa(int(*val1.Number)), "")
+		output.addWarning(ChangedName, val1.GetName(), val2.GetName(), path, strconv.Itoa(int(val1.GetNumber())), "")
 	}
-	if *val1.Type != *val2.Type {
-		compatible := false
-		if *val1.Type == descriptor.FieldDescriptorProto_TYPE_INT32 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_INT64 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_UINT32 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_UINT64 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_BOOL {
-			if *val2.Type == descriptor.FieldDescriptorProto_TYPE_INT32 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_INT64 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_UINT32 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_UINT64 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_BOOL {
-				compatible = true
-			}
+	if val1.GetType() != val2.GetType() {
+		output.addTypeChange(ChangedType, val1.GetType(), val2.GetType(), path, strconv.Itoa(int(val1.GetNumber())))
+	}
+	if val1.GetDefaultValue() != val2.GetDefaultValue() {
+		message := ""
+		if isProto3(c.files[val1]) {
+			message = ", proto3 does not support default values"
 		}
-		if *val1.Type == descriptor.FieldDescriptorProto_TYPE_SINT32 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_SINT64 {
-			if *val2.Type == descriptor.FieldDescriptorProto_TYPE_SINT32 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_SINT64 {
-				compatible = true
-			}
+		output.addWarning(ChangedDefault, val1.GetDefaultValue(), val2.GetDefaultValue(), path, strconv.Itoa(int(val1.GetNumber())), message)
+	}
+	output.merge(compareProto3Fields(val1, val2, path, c))
+	if e1, e2 := mapEntry(val1, c.newer), mapEntry(val2, c.older); e1 != nil || e2 != nil {
+		output.merge(compareMaps(val1, val2, e1, e2, path, c))
+	} else if val1.GetTypeName() != val2.GetTypeName() && val1.GetTypeName() != "" && val2.GetTypeName() != "" && !renamedTypes(val1.GetTypeName(), val2.GetTypeName(), c) { //changes from or to scalars are reported by their type, renames by RenamedMessage and RenamedEnum
+		d1, d2 := c.newer.message(val1.GetTypeName()), c.older.message(val2.GetTypeName())
+		if d1 != nil && d2 != nil { //enums have no fields to compare
+			output.addWarning(ChangedTypeName, val1.GetTypeName(), val2.GetTypeName(), path, strconv.Itoa(int(val1.GetNumber())), ", the two types are compared and their differences are listed with the paths that reach them")
+			c.pairs.reach(d1, d2, val1.GetTypeName(), path+"."+val1.GetName())
+		} else {
+			output.addWarning(ChangedTypeName, val1.GetTypeName(), val2.GetTypeName(), path, strconv.Itoa(int(val1.GetNumber())), "")
 		}
-		if *val1.Type == descriptor.FieldDescriptorProto_TYPE_STRING || *val1.Type == descriptor.FieldDescriptorProto_TYPE_BYTES {
-			if *val2.Type == descriptor.FieldDescriptorProto_TYPE_STRING || *val2.Type == descriptor.FieldDescriptorProto_TYPE_BYTES {
-				compatible = true
+	}
+	return output.at(c, val1, val2)
+}
+
+func getChangesEVDP(newer, older []*descriptor.EnumValueDescriptorProto, path string, open bool, c Comparer) DifferenceList {
+	var output DifferenceList
+	policy := c.EnumPolicy
+	for _, val1 := range newer { //enum values are identified by their number on the wire, like fields
+		renumbered := false
+		for _, val2 := range older {
+			if val1.GetName() == val2.GetName() && val1.GetNumber() != val2.GetNumber() { //even if the number was taken, as in a swap
+				renumbered = true
+				output.addError(ChangedEnumValueNumber, strconv.Itoa(int(val1.GetNumber())), strconv.Itoa(int(val2.GetNumber())), path, val1.GetName(), "").at(c, val1, val2)
 			}
 		}
-		if *val1.Type == descriptor.FieldDescriptorProto_TYPE_FIXED32 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_FIXED64 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_SFIXED32 || *val1.Type == descriptor.FieldDescriptorProto_TYPE_SFIXED64 {
-			if *val2.Type == descriptor.FieldDescriptorProto_TYPE_FIXED32 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_FIXED64 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_SFIXED32 || *val2.Type == descriptor.FieldDescriptorProto_TYPE_SFIXED64 {
-				compatible = true
+		if !renumbered && enumNames(older, val1.GetNumber()) == nil {
+			message := ", old readers treat it as an unknown field of this closed enum"
+			if open {
+				message = ", old readers keep unknown values of this open enum"
+			}
+			if policy == EnumPolicyStrict || (policy == EnumPolicyOpenness && !open) {
+				output.addError(AddedField, val1.GetName(), "", path, strconv.Itoa(int(val1.GetNumber())), message).breaks(ModeForward).at(c, val1, nil)
+			} else {
+				output.addWarning(AddedField, val1.GetName(), "", path, strconv.Itoa(int(val1.GetNumber())), message).at(c, val1, nil)
 			}
 		}
-		if compatible {
-			output.addWarning(ChangedType, val1.Type.String(), val2.Type.String(), path, strconv.Itoa(int(*val1.Number)), "")
-		} else {
-			output.addError(ChangedType, val1.Type.String(), val2.Type.String(), path, strconv.Itoa(int(*val1.Number)), "")
+	}
+	seen := make(map[int32]bool)
+	for _, val1 := range older {
+		if seen[val1.GetNumber()] {
+			continue
+		}
+		seen[val1.GetNumber()] = true
+		newNames, oldNames := enumNames(newer, val1.GetNumber()), enumNames(older, val1.GetNumber())
+		if newNames == nil {
+			renumbered := false
+			for _, val2 := range newer {
+				if val1.GetName() == val2.GetName() {
+					renumbered = true
+				}
+			}
+			if renumbered {
+				continue
+			}
+			if open && val1.GetNumber() == 0 {
+				output.addError(RemovedZeroValue, val1.GetName(), "", path, "0", ", readers of open enums use it for unset and unknown values").breaks(ModeBackward).at(c, nil, val1)
+			} else {
+				output.addError(RemovedField, val1.GetName(), "", path, strconv.Itoa(int(val1.GetNumber())), "").breaks(ModeBackward).at(c, nil, val1) //old data may still use it
+			}
+		} else if !sameNames(keptNames(newNames, older, val1.GetNumber()), keptNames(oldNames, newer, val1.GetNumber())) {
+			output.addWarning(ChangedEnumValueName, strings.Join(newNames, "/"), strings.Join(oldNames, "/"), path, strconv.Itoa(int(val1.GetNumber())), ", JSON and text format readers of the other version can no longer parse the old name").at(c, enumValue(newer, val1.GetNumber()), val1)
 		}
 	}
-	if val1.DefaultValue != val2.DefaultValue {
-		output.addWarning(ChangedDefault, val1.GetDefaultValue(), val2.GetDefaultValue(), path, strconv.Itoa(int(*val1.Number)), "")
+	return output
+}
+
+// enumNames returns the names of all values with the given number, which
+// are several if the enum allows aliases.
+func enumNames(values []*descriptor.EnumValueDescriptorProto, number int32) []string {
+	var names []string
+	for _, val := range values {
+		if val.GetNumber() == number {
+			names = append(names, val.GetName())
+		}
 	}
-	if val1.GetTypeName() != val2.GetTypeName() {
-		output.addWarning(ChangedTypeName, *val1.TypeName, *val2.TypeName, path, strconv.Itoa(int(*val1.Number)), "")
-		d1 := GetDescriptor(val1.GetTypeName(), c.Newer)
-		d2 := GetDescriptor(val2.GetTypeName(), c.Older)
-		output.merge(getChangesFieldDP(d1.Field, d2.Field, d1.ExtensionRange, d2.ExtensionRange, path+"."+d1.GetName(), c))
-		output.merge(getChangesDP(d1.NestedType, d2.NestedType, path+"."+d1.GetName(), c))
-		output.merge(getChangesEDP(d1.EnumType, d2.EnumType, path+"."+d1.GetName()))
+	return names
+}
+
+// enumValue returns the first value with the given number.
+func enumValue(values []*descriptor.EnumValueDescriptorProto, number int32) *descriptor.EnumValueDescriptorProto {
+	for _, val := range values {
+		if val.GetNumber() == number {
+			return val
+		}
 	}
-	return output
+	return nil
 }
 
-func getChangesEVDP(newer, older []*descriptor.EnumValueDescriptorProto, path string) DifferenceList {
-	var output DifferenceList
-	for _, val1 := range newer {
-		exist := false
-		for _, val2 := range older {
-			if val1.GetName() == val2.GetName() {
-				exist = true
+// keptNames returns the names that the other version does not give another
+// number, since renumbered values are reported as such.
+func keptNames(names []string, other []*descriptor.EnumValueDescriptorProto, number int32) []string {
+	var kept []string
+	for _, name := range names {
+		moved := false
+		for _, val := range other {
+			if val.GetName() == name && val.GetNumber() != number {
+				moved = true
 			}
 		}
-		if !exist {
-			output.addError(AddedField, val1.GetName(), "", path, strconv.Itoa(int(*val1.Number)), "")
+		if !moved {
+			kept = append(kept, name)
 		}
 	}
-	for _, val1 := range older {
-		exist := false
-		for _, val2 := range newer {
-			if val1.GetName() == val2.GetName() {
-				exist = true
+	return kept
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, name := range a {
+		found := false
+		for _, other := range b {
+			if name == other {
+				found = true
 			}
 		}
-		if !exist {
-			output.addError(RemovedField, val1.GetName(), "", path, strconv.Itoa(int(*val1.Number)), "")
+		if !found {
+			return false
 		}
 	}
-	return output
+	return true
 }
 
 func isExtension(tag int, ext []*descriptor.DescriptorProto_ExtensionRange) bool {
 	for _, val1 := range ext {
-		if tag >= int(*val1.Start) && tag <= int(*val1.End) {
+		if tag >= int(val1.GetStart()) && tag < int(val1.GetEnd()) { //the end is exclusive
 			return true
 		}
 	}
 	return false
 }
-
-func main() {
-	if len(os.Args) == 5 {
-		newer, err1 := parser.ParseFile(os.Args[1], strings.Split(os.Args[2], ":")...)
-		check(err1)
-		older, err2 := parser.ParseFile(os.Args[3], strings.Split(os.Args[4], ":")...)
-		check(err2)
-		c := Comparer{newer, older}
-		d := c.Compare()
-		fmt.Print(d.String(false))
-		if d.Error != nil {
-			os.Exit(1)
-		}
-	} else if len(os.Args) == 6 {
-		newer, err1 := parser.ParseFile(os.Args[1], strings.Split(os.Args[2], ":")...)
-		check(err1)
-		older, err2 := parser.ParseFile(os.Args[3], strings.Split(os.Args[4], ":")...)
-		check(err2)
-		c := Comparer{newer, older}
-		d := c.Compare()
-		fmt.Println(d.String(false))
-		if d.Error != nil {
-			os.Exit(1)
-		}
-	} else if len(os.Args) == 1 {
-		newer, err1 := parser.ParseFile("./ExtensionProtos/Changes/p.proto", "./ExtensionProtos/Changes")
-		check(err1)
-		older, err2 := parser.ParseFile("./ExtensionProtos/p.proto", "./ExtensionProtos/")
-		check(err2)
-		c := Comparer{newer, older}
-		d := c.Compare()
-		fmt.Print(d.String(false))
-		if d.Error != nil {
-			os.Exit(1)
-		}
-	} else {
-		fmt.Println(len(os.Args))
-		fmt.Println("Use either 0 parameters for hard coded imports or 4,5 paramters to pass relative filepath")
-		fmt.Println("Use parameters {proto path 1} {proto 1 dependancies} {proto path 2} {proto 2 dependancies} if there is more than 1 dependency for a proto seperate them by \":\"")
-		os.Exit(1)
-	}
-}
@@ -15,18 +15,31 @@
 package compatibility
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"github.com/gogo/protobuf/parser"
+	"github.com/gogo/protobuf/proto"
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
 	"strconv"
+	"strings"
 	"testing"
 )
 
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
 func TestByteString(t *testing.T) {
 	newer, err1 := parser.ParseFile("./TestProtos/BytesStringProtos/Changes/Original.proto", "./TestProtos/BytesStringProtos/Changes")
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/BytesStringProtos/Original.proto", "./TestProtos/BytesStringProtos")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if !d.IsCompatible() {
 		t.Error("Changes to BYTES or STRING broke the compatibility")
 	}
@@ -37,10 +50,24 @@ func TestFixed(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/FixedProtos/Original.proto", "./TestProtos/FixedProtos")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
-	if !d.IsCompatible() {
-		t.Error("Changes to fixed integer types broke the compatibility")
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	//fixed32 and sfixed32 share a wire type, and so do fixed64 and sfixed64, but fixed32 and fixed64 do not
+	if len(d.Error) != 8 {
+		t.Error("Expected 8 changes between 32 and 64 bit fixed types to break the compatibility, found " + strconv.Itoa(len(d.Error)))
+	}
+	lossy := 0
+	for _, val := range d.Warning {
+		if val.Condition == ChangedType {
+			if val.Severity != SeverityLossy || !strings.Contains(val.Message, "change sign") {
+				t.Error("Expected a lossy sign change, found " + val.String())
+			}
+			lossy++
+		}
+	}
+	if lossy != 4 {
+		t.Error("Expected 4 lossy sign changes, found " + strconv.Itoa(lossy))
 	}
 }
 
@@ -49,8 +76,9 @@ func TestIncompatibility(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/Incompatibility/Changes/Original.proto", "./TestProtos/Incompatibility/Changes/")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if len(d.Error) != 87 {
 		t.Error(strconv.Itoa(len(d.Error)) + " incompatibilities out of 87")
 	}
@@ -61,8 +89,9 @@ func TestOptionalRepeated(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/OptionalRepeatedProtos/Original.proto", "./TestProtos/OptionalRepeatedProtos")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if !d.IsCompatible() {
 		t.Error("Switching between labels broke the compatibility")
 	}
@@ -73,8 +102,9 @@ func TestInt(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/IntProtos/Original.proto", "./TestProtos/IntProtos")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if !d.IsCompatible() {
 		t.Error("Changes to integer types broke the compatibility")
 	}
@@ -85,13 +115,14 @@ func TestNestedAdded(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/NestedProtos/NestedAdded/Original.proto", "./TestProtos/NestedProtos/NestedAdded")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if len(d.Error) != 2 {
 		t.Error("Expected 2 errors, found " + strconv.Itoa(len(d.Error)))
 	}
 	for _, val := range d.Error {
-		if val.condition != AddedField {
+		if val.Condition != AddedField {
 			t.Error("Incompatible error condition: Not AddedField")
 		}
 	}
@@ -102,13 +133,14 @@ func TestNestedLabel(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/NestedProtos/NestedLabel/Original.proto", "./TestProtos/NestedProtos/NestedLabel")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if len(d.Error) != 4 {
 		t.Error("Expected 4 errors, found " + strconv.Itoa(len(d.Error)))
 	}
 	for _, val := range d.Error {
-		if val.condition != ChangedLabel {
+		if val.Condition != ChangedLabel {
 			t.Error("Incompatible error condition: Not ChangedLabel")
 		}
 	}
@@ -119,13 +151,14 @@ func TestNestedRemoved(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./TestProtos/NestedProtos/NestedRemoved/Original.proto", "./TestProtos/NestedProtos/NestedRemoved")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if len(d.Error) != 2 {
 		t.Error("Expected 2 errors, found " + strconv.Itoa(len(d.Error)))
 	}
 	for _, val := range d.Error {
-		if val.condition != RemovedField {
+		if val.Condition != RemovedField {
 			t.Error("Incompatible error condition: Not RemovedField")
 		}
 	}
@@ -136,9 +169,704 @@ func TestExtensions(t *testing.T) {
 	check(err1)
 	older, err2 := parser.ParseFile("./ExtensionProtos/Changes/p.proto", "./ExtensionProtos/Changes/")
 	check(err2)
-	c := Comparer{newer, older}
-	d := c.Compare()
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
 	if !d.IsCompatible() {
 		t.Error("Extensions not handled properly")
 	}
+	if len(d.Extension) != 2 {
+		t.Fatal("Expected apples and b to be converted to extensions, found " + strconv.Itoa(len(d.Extension)) + " extension differences")
+	}
+	for _, val := range d.Extension {
+		if val.Condition != ConvertedExtension || val.NewValue != "extension" || val.OldValue != "field" || val.Qualifier != "2" {
+			t.Error("Unexpected extension difference " + val.String())
+		}
+	}
+}
+
+func TestExtensionRanges(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/ExtensionRangeProtos/Changes/Original.proto", "./TestProtos/ExtensionRangeProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/ExtensionRangeProtos/Original.proto", "./TestProtos/ExtensionRangeProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 1 || d.Error[0].Condition != RemovedExtensionRange || d.Error[0].OldValue != "121 to 199" || d.Error[0].Path != ".Base" {
+		t.Error("Expected an error for removing the extension numbers used by note")
+	}
+	var removed []string
+	for _, val := range d.Extension {
+		removed = append(removed, val.Path+" "+val.OldValue)
+	}
+	if strings.Join(removed, ", ") != ".Base 121 to 199, .Base 500 to max, .Other 10 to 14, .Other 16 to 20" {
+		t.Error("Unexpected removed extension ranges " + strings.Join(removed, ", "))
+	}
+	if !isExtension(120, newer.File[0].MessageType[0].ExtensionRange) || isExtension(121, newer.File[0].MessageType[0].ExtensionRange) {
+		t.Error("Expected extension ranges to exclude their end")
+	}
+}
+
+func TestProto3(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/Proto3Protos/Changes/Original.proto", "./TestProtos/Proto3Protos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/Proto3Protos/Original.proto", "./TestProtos/Proto3Protos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if !d.IsCompatible() {
+		t.Error("Presence, packing or open enum changes broke the compatibility")
+	}
+	expected := map[Condition]int{ChangedPresence: 2, ChangedPacked: 1, AddedField: 1}
+	found := make(map[Condition]int)
+	for _, val := range d.Warning {
+		found[val.Condition]++
+	}
+	for cond, n := range expected {
+		if found[cond] != n {
+			t.Error("Expected " + strconv.Itoa(n) + " " + cond.String() + " warnings, found " + strconv.Itoa(found[cond]))
+		}
+	}
+}
+
+func TestSyntax(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/SyntaxProtos/Changes/Original.proto", "./TestProtos/SyntaxProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/SyntaxProtos/Original.proto", "./TestProtos/SyntaxProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if !d.IsCompatible() {
+		t.Error("Switching from proto2 to proto3 broke the compatibility")
+	}
+	expected := []Condition{ChangedSyntax, ChangedDefault, ChangedPresence, ChangedPacked}
+	if len(d.Warning) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " warnings, found " + strconv.Itoa(len(d.Warning)))
+	}
+	for i, val := range d.Warning {
+		if val.Condition != expected[i] {
+			t.Error("Expected " + expected[i].String() + ", found " + val.Condition.String())
+		}
+	}
+}
+
+func TestServices(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/ServiceProtos/Changes/Original.proto", "./TestProtos/ServiceProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/ServiceProtos/Original.proto", "./TestProtos/ServiceProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	expected := []Condition{ChangedMethodOutputType, ChangedStreaming, ChangedStreaming, RemovedMethod, RemovedService}
+	if len(d.Error) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " errors, found " + strconv.Itoa(len(d.Error)))
+	}
+	for i, val := range d.Error {
+		if val.Condition != expected[i] {
+			t.Error("Expected " + expected[i].String() + ", found " + val.Condition.String())
+		}
+	}
+	if len(d.Warning) != 2 {
+		t.Fatal("Expected 2 warnings for the added method and service, found " + strconv.Itoa(len(d.Warning)))
+	}
+	if d.Warning[0].Path != ".Search.Count" || d.Warning[0].Qualifier != "Count" || d.Warning[1].Path != ".Stats" || d.Warning[1].Qualifier != "Stats" {
+		t.Error("Expected the added method and service to be identified by their path and name, found " + d.Warning[0].Path + " and " + d.Warning[1].Path)
+	}
+}
+
+func TestOneof(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/OneofProtos/Changes/Original.proto", "./TestProtos/OneofProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/OneofProtos/Original.proto", "./TestProtos/OneofProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	expected := []Condition{SplitOneof, SplitOneof, MovedIntoOneof, MovedIntoOneof, MovedBetweenOneofs, MovedOutOfOneof, MovedOutOfOneof}
+	if len(d.Error) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " errors, found " + strconv.Itoa(len(d.Error)))
+	}
+	for i, val := range d.Error {
+		if val.Condition != expected[i] {
+			t.Error("Expected " + expected[i].String() + ", found " + val.Condition.String())
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/MapProtos/Changes/Original.proto", "./TestProtos/MapProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/MapProtos/Original.proto", "./TestProtos/MapProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 1 || d.Error[0].Condition != ChangedMapKey || d.Error[0].Path != ".Foo.labels[key]" {
+		t.Error("Expected a single ChangedMapKey error for .Foo.labels[key]")
+	}
+	expected := []Condition{ChangedMapValue, ChangedMapValue, ConvertedMap}
+	if len(d.Warning) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " warnings, found " + strconv.Itoa(len(d.Warning)))
+	}
+	for i, val := range d.Warning {
+		if val.Condition != expected[i] {
+			t.Error("Expected " + expected[i].String() + ", found " + val.Condition.String())
+		}
+	}
+
+	newer, err1 = parser.ParseFile("./TestProtos/MapProtos/Scalar/Changes/Original.proto", "./TestProtos/MapProtos/Scalar/Changes")
+	check(err1)
+	older, err2 = parser.ParseFile("./TestProtos/MapProtos/Scalar/Original.proto", "./TestProtos/MapProtos/Scalar")
+	check(err2)
+	c = Comparer{Newer: newer, Older: older}
+	d, err = c.Compare()
+	check(err)
+	if len(d.Error) != 1 || d.Error[0].Condition != ChangedType {
+		t.Error("Expected a scalar converted to a map to be a ChangedType error")
+	}
+	for _, val := range d.Warning {
+		if val.Condition == ConvertedMap {
+			t.Error("Unexpected warning " + val.String())
+		}
+	}
+}
+
+func TestEnumValues(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/EnumProtos/Changes/Original.proto", "./TestProtos/EnumProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/EnumProtos/Original.proto", "./TestProtos/EnumProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	//PERSONAL and BUSINESS swapped their numbers, DISABLED moved to an unused one
+	renumbered := []string{"PERSONAL", "BUSINESS", "DISABLED"}
+	if len(d.Error) != len(renumbered) {
+		t.Fatal("Expected " + strconv.Itoa(len(renumbered)) + " errors, found " + strconv.Itoa(len(d.Error)))
+	}
+	for i, val := range d.Error {
+		if val.Condition != ChangedEnumValueNumber || val.Qualifier != renumbered[i] {
+			t.Error("Expected " + renumbered[i] + " to be renumbered, found " + val.String())
+		}
+	}
+	expected := []Condition{ChangedAllowAlias, ChangedEnumValueName, ChangedEnumValueName}
+	if len(d.Warning) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " warnings, found " + strconv.Itoa(len(d.Warning)))
+	}
+	for i, val := range d.Warning {
+		if val.Condition != expected[i] {
+			t.Error("Expected " + expected[i].String() + ", found " + val.Condition.String())
+		}
+	}
+}
+
+func TestEnumZeroValue(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/EnumZeroProtos/Changes/Original.proto", "./TestProtos/EnumZeroProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/EnumZeroProtos/Original.proto", "./TestProtos/EnumZeroProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 1 || d.Error[0].Condition != RemovedZeroValue {
+		t.Error("Expected a single RemovedZeroValue error")
+	}
+}
+
+func TestEnumPolicy(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/EnumPolicyProtos/Changes/Original.proto", "./TestProtos/EnumPolicyProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/EnumPolicyProtos/Original.proto", "./TestProtos/EnumPolicyProtos")
+	check(err2)
+	policies := []EnumPolicy{EnumPolicyOpenness, EnumPolicyStrict, EnumPolicyLenient}
+	errors := []int{1, 2, 0}
+	for i, policy := range policies {
+		c := Comparer{Newer: newer, Older: older, EnumPolicy: policy}
+		d, err := c.Compare()
+		check(err)
+		if len(d.Error) != errors[i] || len(d.Error)+len(d.Warning) != 2 {
+			t.Error("Expected " + strconv.Itoa(errors[i]) + " errors for enum policy " + strconv.Itoa(int(policy)) + ", found " + strconv.Itoa(len(d.Error)))
+		}
+	}
+}
+
+func TestReserved(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/ReservedProtos/Changes/Original.proto", "./TestProtos/ReservedProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/ReservedProtos/Original.proto", "./TestProtos/ReservedProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	expected := []Condition{ReusedReservedNumber, ReusedReservedName, RemovedReservedNumber, RemovedReservedNumber}
+	if len(d.Error) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " errors, found " + strconv.Itoa(len(d.Error)))
+	}
+	for i, val := range d.Error {
+		if val.Condition != expected[i] {
+			t.Error("Expected " + expected[i].String() + ", found " + val.Condition.String())
+		}
+	}
+	if d.Error[2].OldValue != "9" || d.Error[3].OldValue != "20" {
+		t.Error("Expected reserved numbers 9 and 20 to be removed, found " + d.Error[2].OldValue + " and " + d.Error[3].OldValue)
+	}
+	if len(d.Warning) != 1 || d.Warning[0].Condition != RemovedField || d.Warning[0].Qualifier != "10" {
+		t.Error("Expected a single RemovedField warning for field nr 10")
+	}
+	c = Comparer{Newer: newer, Older: older, RequireReserved: true}
+	d, err = c.Compare()
+	check(err)
+	if len(d.Error) != len(expected)+2 || len(d.Warning) != 0 {
+		t.Fatal("Expected removing fields nr 10 and 11 without reserving them to be errors")
+	}
+	if d.Error[1].Qualifier != "11" || d.Error[1].Message != " without reserving its name mobile" {
+		t.Error("Expected removing field nr 11 without reserving its name to be an error, found " + d.Error[1].String())
+	}
+}
+
+func TestDifferenceJSON(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/MapProtos/Changes/Original.proto", "./TestProtos/MapProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/MapProtos/Original.proto", "./TestProtos/MapProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	data, err := json.Marshal(d)
+	check(err)
+	var decoded DifferenceList
+	check(json.Unmarshal(data, &decoded))
+	if len(decoded.Error) != 1 || len(decoded.Warning) != len(d.Warning) {
+		t.Fatal("Unexpected differences after decoding " + string(data))
+	}
+	got, want := decoded.Error[0], d.Error[0]
+	if got.String() != want.String() || got.Qualifier != want.Qualifier || got.File != want.File {
+		t.Error("Expected " + want.String() + ", decoded " + got.String())
+	}
+	if got.Condition != ChangedMapKey || got.Severity != SeverityError || got.RuleID != "PC023" || got.File != "Original.proto" {
+		t.Error("Unexpected fields in " + string(data))
+	}
+	if !strings.Contains(string(data), `"condition":"ChangedMapKey","severity":"error"`) {
+		t.Error("Expected conditions and severities to be encoded by name in " + string(data))
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/MapProtos/Changes/Original.proto", "./TestProtos/MapProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/MapProtos/Original.proto", "./TestProtos/MapProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	data, err := d.SARIF()
+	check(err)
+	var log sarifLog
+	check(json.Unmarshal(data, &log))
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(Conditions()) {
+		t.Fatal("Unexpected SARIF log " + string(data))
+	}
+	results := log.Runs[0].Results
+	if len(results) != len(d.Error)+len(d.Warning) {
+		t.Fatal("Expected a result for every difference in " + string(data))
+	}
+	r := results[0]
+	if r.RuleID != "PC023" || r.Level != "error" || log.Runs[0].Tool.Driver.Rules[r.RuleIndex].ID != r.RuleID {
+		t.Error("Unexpected result " + string(data))
+	}
+	if len(r.Locations) != 1 || r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "Original.proto" {
+		t.Error("Expected the result to be located in Original.proto")
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/MapProtos/Changes/Original.proto", "./TestProtos/MapProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/MapProtos/Original.proto", "./TestProtos/MapProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	data, err := d.JUnit()
+	check(err)
+	var report junitTestSuites
+	check(xml.Unmarshal(data, &report))
+	if len(report.Suites) != 1 {
+		t.Fatal("Expected a single test suite in " + string(data))
+	}
+	suite := report.Suites[0]
+	if suite.Tests != 4 || suite.Failures != 1 {
+		t.Error("Expected 4 test cases and 1 failure, found " + strconv.Itoa(suite.Tests) + " and " + strconv.Itoa(suite.Failures))
+	}
+	for _, val := range suite.Cases {
+		if val.Name == "message .Foo" {
+			if len(val.Failures) != 1 || val.Failures[0].Type != "ChangedMapKey" || !strings.Contains(val.SystemOut, "WARNING PC024") || !strings.Contains(val.SystemOut, "LOSSY PC024") {
+				t.Error("Expected the map key error and the warnings in message .Foo, found " + string(data))
+			}
+		} else if len(val.Failures) != 0 {
+			t.Error("Unexpected failure in " + val.Name)
+		}
+	}
+}
+
+func TestLocations(t *testing.T) {
+	newer, err1 := ReadFile("./TestProtos/MapProtos/Changes/Original.proto", "./TestProtos/MapProtos/Changes")
+	check(err1)
+	older, err2 := ReadFile("./TestProtos/MapProtos/Original.proto", "./TestProtos/MapProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 1 {
+		t.Fatal("Expected a single error, found " + strconv.Itoa(len(d.Error)))
+	}
+	expected := Location{File: "Original.proto", Line: 8, Column: 3}
+	if d.Error[0].NewLocation == nil || *d.Error[0].NewLocation != expected || d.Error[0].OldLocation == nil || *d.Error[0].OldLocation != expected {
+		t.Error("Expected the map key error at " + expected.String())
+	}
+	if s := d.Error[0].String(); !strings.HasPrefix(s, "Original.proto:8:3: Changed type of map key") {
+		t.Error("Expected the location in " + s)
+	}
+	converted := d.Warning[len(d.Warning)-1]
+	if converted.Condition != ConvertedMap || converted.NewLocation == nil || converted.NewLocation.Line != 11 {
+		t.Error("Expected the converted map at line 11, found " + converted.String())
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	field := func(name string, number int32, typ descriptor.FieldDescriptorProto_Type, typeName string) *descriptor.FieldDescriptorProto {
+		f := &descriptor.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	set := func(fields ...*descriptor.FieldDescriptorProto) *descriptor.FileDescriptorSet {
+		return &descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{{
+			Name:        proto.String("test.proto"),
+			Package:     proto.String("test"),
+			MessageType: []*descriptor.DescriptorProto{{Name: proto.String("Foo"), Field: fields}, {Name: proto.String("Bar")}},
+			EnumType:    []*descriptor.EnumDescriptorProto{{Name: proto.String("Kind")}, {Name: proto.String("Mode")}},
+		}}}
+	}
+	valid := set(field("bar", 1, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".test.Bar"))
+
+	unnumbered := set(field("bar", 1, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".test.Bar"))
+	unnumbered.File[0].MessageType[0].Field[0].Number = nil
+	c := Comparer{Newer: unnumbered, Older: valid}
+	if _, err := c.Compare(); err == nil {
+		t.Error("Expected an error for a field without a number")
+	} else if _, ok := err.(*MalformedDescriptorError); !ok {
+		t.Error("Expected a MalformedDescriptorError, found " + err.Error())
+	}
+
+	c = Comparer{Newer: valid, Older: set(field("bar", 1, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".test.Missing"))}
+	if _, err := c.Compare(); err == nil {
+		t.Error("Expected an error for an unresolved type")
+	} else if e, ok := err.(*UnresolvedTypeError); !ok || e.Type != ".test.Missing" || e.Element != ".test.Foo.bar" {
+		t.Error("Expected an UnresolvedTypeError for .test.Missing, found " + err.Error())
+	}
+
+	c = Comparer{Newer: valid, Older: set(field("kind", 2, descriptor.FieldDescriptorProto_TYPE_ENUM, ".test.Missing"))}
+	if _, err := c.Compare(); err == nil {
+		t.Error("Expected an error for an unresolved enum")
+	} else if e, ok := err.(*UnresolvedTypeError); !ok || e.Type != ".test.Missing" || e.Element != ".test.Foo.kind" {
+		t.Error("Expected an UnresolvedTypeError for .test.Missing, found " + err.Error())
+	}
+
+	extended := set()
+	extended.File[0].Extension = []*descriptor.FieldDescriptorProto{field("ext", 100, descriptor.FieldDescriptorProto_TYPE_INT32, "")}
+	extended.File[0].Extension[0].Extendee = proto.String(".other.Foo")
+	c = Comparer{Newer: extended, Older: set()}
+	if _, err := c.Compare(); err == nil {
+		t.Error("Expected an error for an extension of an unresolved message")
+	} else if _, ok := err.(*UnresolvedTypeError); !ok {
+		t.Error("Expected an UnresolvedTypeError, found " + err.Error())
+	}
+
+	c = Comparer{Newer: set(field("kind", 2, descriptor.FieldDescriptorProto_TYPE_ENUM, ".test.Kind")), Older: set(field("kind", 2, descriptor.FieldDescriptorProto_TYPE_ENUM, ".test.Mode"))}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Warning) != 1 || d.Warning[0].Condition != ChangedTypeName {
+		t.Error("Expected a single ChangedTypeName warning for an enum field")
+	}
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/RecursiveProtos/Changes/Original.proto", "./TestProtos/RecursiveProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/RecursiveProtos/Original.proto", "./TestProtos/RecursiveProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 2 {
+		t.Fatal("Expected 2 errors, found " + strconv.Itoa(len(d.Error)))
+	}
+	if d.Error[0].Condition != ChangedType || d.Error[0].Path != ".Element" || strings.Join(d.Error[0].Via, " ") != ".Holder.first .Holder.second .Element.next" {
+		t.Error("Expected a single ChangedType error in .Element reached through every field, found " + d.Error[0].String())
+	}
+	if d.Error[1].Condition != AddedField || d.Error[1].Path != ".PongV2" || strings.Join(d.Error[1].Via, " ") != ".PingV2.pong" {
+		t.Error("Expected a single AddedField error in .PongV2 reached through .PingV2.pong, found " + d.Error[1].String())
+	}
+}
+
+func TestPackages(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/PackageProtos/Changes/Original.proto", "./TestProtos/PackageProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/PackageProtos/Original.proto", "./TestProtos/PackageProtos")
+	check(err2)
+	foo, bar := GetDescriptor(".foo.v1.User", newer), GetDescriptor(".bar.v1.User", newer)
+	if foo == nil || bar == nil || foo == bar {
+		t.Fatal("Expected .foo.v1.User and .bar.v1.User to resolve to different messages")
+	}
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	symbols := newSymbolTable(newer)
+	if len(symbols.fields(bar)) != 3 || len(symbols.fields(foo)) != 2 || len(bar.Field) != 2 {
+		t.Error("Expected the extension to be compared with .bar.v1.User only, without changing it")
+	}
+	if len(d.Error) != 1 || d.Error[0].Condition != ChangedType || d.Error[0].Path != ".bar.v1.User" || strings.Join(d.Error[0].Via, " ") != ".app.Holder.user" {
+		t.Error("Expected a single ChangedType error in .bar.v1.User reached through .app.Holder.user")
+	}
+	if len(d.Warning) != 1 || d.Warning[0].Condition != ChangedTypeName {
+		t.Fatal("Expected a single ChangedTypeName warning, found " + strconv.Itoa(len(d.Warning)))
+	}
+	if !strings.Contains(d.Warning[0].String(), "the two types are compared") {
+		t.Error("Expected the warning to say that the types are compared, found " + d.Warning[0].String())
+	}
+}
+
+func TestSplitPackage(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/SplitProtos/Changes/Original.proto", "./TestProtos/SplitProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/SplitProtos/Original.proto", "./TestProtos/SplitProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 1 || d.Error[0].Condition != ChangedType || d.Error[0].Path != ".shop.Item" || d.Error[0].File != "items.proto" {
+		t.Error("Expected a single ChangedType error in .shop.Item of items.proto")
+	}
+	moved := 0
+	for _, val := range d.Warning {
+		switch val.Condition {
+		case MovedBetweenFiles:
+			moved++
+			if val.OldValue != "Original.proto" || val.NewValue != "items.proto" || val.Severity != SeverityInfo {
+				t.Error("Unexpected move " + val.String())
+			}
+		case NonFieldIncompatibility:
+			if val.Message != "Added proto file items" || val.Path != "items.proto" || val.Qualifier != "items" {
+				t.Error("Unexpected warning " + val.String())
+			}
+		default:
+			t.Error("Unexpected warning " + val.String())
+		}
+	}
+	if moved != 2 {
+		t.Error("Expected .Item and .Status to be moved, found " + strconv.Itoa(moved) + " moves")
+	}
+	if !strings.Contains(d.String(false), "INFO\nMoved message .shop.Item") {
+		t.Error("Expected the moves to be listed under INFO")
+	}
+}
+
+func TestRenames(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/RenameMessage/Changes/Original.proto", "./TestProtos/RenameMessage/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/RenameMessage/Original.proto", "./TestProtos/RenameMessage")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 1 || d.Error[0].Condition != ChangedType || d.Error[0].Path != ".w" {
+		t.Error("Expected a single ChangedType error in the renamed message .w, found " + strconv.Itoa(len(d.Error)) + " errors")
+	}
+	renames := 0
+	for _, val := range d.Warning {
+		switch val.Condition {
+		case RenamedMessage:
+			renames++
+			if (val.OldValue != ".r" || val.NewValue != ".w") && (val.OldValue != ".m.Inner" || val.NewValue != ".m.Nested") {
+				t.Error("Unexpected rename " + val.String())
+			}
+		case RenamedEnum:
+			renames++
+			if val.OldValue != ".Color" || val.NewValue != ".Colour" {
+				t.Error("Unexpected rename " + val.String())
+			}
+		case NonFieldIncompatibility, ChangedTypeName:
+			t.Error("Expected renames instead of " + val.String())
+		}
+	}
+	if renames != 3 {
+		t.Error("Expected .r, .m.Inner and .Color to be renamed, found " + strconv.Itoa(renames) + " renames")
+	}
+}
+
+func TestModes(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/ModeProtos/Changes/Original.proto", "./TestProtos/ModeProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/ModeProtos/Original.proto", "./TestProtos/ModeProtos")
+	check(err2)
+	//age and active are required but missing from old data, id is optional but required by old readers, and email changed its wire type
+	expected := map[Mode]int{0: 4, ModeFull: 4, ModeBackward: 3, ModeForward: 2}
+	for mode, errs := range expected {
+		c := Comparer{Newer: newer, Older: older, Mode: mode}
+		d, err := c.Compare()
+		check(err)
+		if len(d.Error) != errs {
+			t.Error("Expected " + strconv.Itoa(errs) + " errors in mode " + mode.String() + ", found " + strconv.Itoa(len(d.Error)))
+		}
+		for _, val := range d.Error {
+			if val.Breaks&mode == 0 && mode != 0 {
+				t.Error("Unexpected error in mode " + mode.String() + ": " + val.String())
+			}
+		}
+		for _, val := range d.Warning {
+			if val.Condition == ChangedLabel && val.Breaks == 0 {
+				t.Error("Expected the direction of a demoted error to be kept: " + val.String())
+			}
+		}
+	}
+}
+
+func TestCompareReuse(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/PackageProtos/Changes/Original.proto", "./TestProtos/PackageProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/PackageProtos/Original.proto", "./TestProtos/PackageProtos")
+	check(err2)
+	before, err := proto.Marshal(older)
+	check(err)
+	c := Comparer{Newer: newer, Older: older}
+	first, err := c.Compare()
+	check(err)
+	results := make(chan DifferenceList, 4)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			d, err := c.Compare()
+			check(err)
+			results <- d
+		}()
+	}
+	for i := 0; i < cap(results); i++ {
+		d := <-results
+		if d.String(false) != first.String(false) {
+			t.Error("Expected every comparison to report the same differences, found " + d.String(false))
+		}
+	}
+	after, err := proto.Marshal(older)
+	check(err)
+	if !bytes.Equal(before, after) {
+		t.Error("Expected Compare to leave the older version untouched")
+	}
+}
+
+func TestExtensionNumbers(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/ExtensionConflictProtos/Changes/a.proto", "./TestProtos/ExtensionConflictProtos/Changes")
+	check(err1)
+	other, err2 := parser.ParseFile("./TestProtos/ExtensionConflictProtos/Changes/b.proto", "./TestProtos/ExtensionConflictProtos/Changes")
+	check(err2)
+	newer.File = append(newer.File, other.File[len(other.File)-1]) //a.proto and b.proto compile separately, but share Original.proto
+	older, err3 := parser.ParseFile("./TestProtos/ExtensionConflictProtos/Original.proto", "./TestProtos/ExtensionConflictProtos")
+	check(err3)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	var found []string
+	for _, val := range d.Error {
+		found = append(found, val.String())
+	}
+	expected := []string{
+		"Reused number 2 in .conflict.Foo for extension .conflict.tag, previously used by label",
+		"Reused number 100 in .conflict.Foo for extension .conflict.comment, previously used by .conflict.note",
+		"Duplicate extension number 150 in .conflict.Foo for .conflict.b.rank, already used by .conflict.a.rank",
+	}
+	if len(found) != len(expected) {
+		t.Fatal("Expected " + strconv.Itoa(len(expected)) + " errors, found:\n" + strings.Join(found, "\n"))
+	}
+	for i := range expected {
+		if !strings.HasSuffix(found[i], expected[i]) {
+			t.Error("Expected " + expected[i] + ", found " + found[i])
+		}
+	}
+	if d.Error[2].File != "b.proto" {
+		t.Error("Expected the duplicate extension to be found in b.proto, found " + d.Error[2].File)
+	}
+	if d.Error[0].Breaks != ModeBackward || d.Error[1].Breaks != ModeBackward {
+		t.Error("Expected reused extension numbers to only break backward compatibility")
+	}
+	if len(d.Extension) != 3 {
+		t.Error("Expected 3 extension differences, found " + strconv.Itoa(len(d.Extension)))
+	}
+	for _, val := range d.Warning {
+		if val.Condition == ConvertedExtension {
+			t.Error("Expected tag to reuse the number of label rather than convert it, found " + val.String())
+		}
+	}
+	c = Comparer{Newer: older, Older: newer}
+	d, err = c.Compare()
+	check(err)
+	duplicates := 0
+	for _, val := range d.Warning {
+		if val.Condition == DuplicateExtension {
+			duplicates++
+			if val.OldValue != ".conflict.b.rank" || val.Path != ".conflict.Foo" || val.File != "b.proto" {
+				t.Error("Unexpected duplicate " + val.String())
+			}
+		}
+	}
+	if duplicates != 1 {
+		t.Error("Expected the duplicate of the older version to give a single warning, found " + strconv.Itoa(duplicates))
+	}
+}
+
+func TestTypeConversions(t *testing.T) {
+	newer, err1 := parser.ParseFile("./TestProtos/TypeConversionProtos/Changes/Original.proto", "./TestProtos/TypeConversionProtos/Changes")
+	check(err1)
+	older, err2 := parser.ParseFile("./TestProtos/TypeConversionProtos/Original.proto", "./TestProtos/TypeConversionProtos")
+	check(err2)
+	c := Comparer{Newer: newer, Older: older}
+	d, err := c.Compare()
+	check(err)
+	if len(d.Error) != 2 || d.Error[0].Qualifier != "4" || d.Error[1].Qualifier != "6" {
+		t.Fatal("Expected the changes from a group to a message and from string to message to break the compatibility")
+	}
+	if !strings.Contains(d.Error[0].Message, "start and end group tags") {
+		t.Error("Expected the change from a group to a message to explain the wire types, found " + d.Error[0].String())
+	}
+	expected := map[string]string{
+		"1": "only compatible if the bytes hold an encoded message",
+		"2": "enums are encoded as int32",
+		"3": "truncate values beyond 32 bits",
+	}
+	for _, val := range d.Warning {
+		if val.Condition == ChangedTypeName {
+			t.Error("Unexpected warning " + val.String())
+		}
+		if val.Condition != ChangedType {
+			continue
+		}
+		if !strings.Contains(val.Message, expected[val.Qualifier]) {
+			t.Error("Expected the caveat of field nr " + val.Qualifier + " to mention " + expected[val.Qualifier] + ", found " + val.String())
+		}
+		if (val.Severity == SeverityLossy) != (val.Qualifier == "3") {
+			t.Error("Expected only the change from int64 to an enum to be lossy, found " + val.Severity.String() + " " + val.String())
+		}
+		delete(expected, val.Qualifier)
+	}
+	if len(expected) != 0 {
+		t.Error("Expected " + strconv.Itoa(len(expected)) + " more type changes")
+	}
 }
@@ -0,0 +1,198 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UnresolvedTypeError is returned when a field or extension refers to a
+// message that is not part of the same FileDescriptorSet.
+type UnresolvedTypeError struct {
+	File    string // file declaring the element
+	Element string // fully qualified element referring to the type
+	Type    string
+}
+
+func (e *UnresolvedTypeError) Error() string {
+	return e.File + ": " + e.Element + " refers to unresolved type " + e.Type
+}
+
+// MalformedDescriptorError is returned when a descriptor lacks a value every
+// compiled schema has, such as the number of a field.
+type MalformedDescriptorError struct {
+	File    string
+	Element string
+	Reason  string
+}
+
+func (e *MalformedDescriptorError) Error() string {
+	if e.Element == "" {
+		return e.File + ": " + e.Reason
+	}
+	return e.File + ": " + e.Element + ": " + e.Reason
+}
+
+// ParseError is returned when protoc rejects a .proto file. Line and Column
+// are 0 if protoc did not report a position.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.File + ": " + e.Message
+	}
+	return e.File + ":" + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column) + ": " + e.Message
+}
+
+var protocError = regexp.MustCompile(`^(.+?):(\d+):(\d+): (.*)$`)
+
+// parseError turns the first line protoc wrote to stderr into a ParseError.
+func parseError(filename, output string) *ParseError {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(output), "\n", 2)[0])
+	if m := protocError.FindStringSubmatch(line); m != nil {
+		l, _ := strconv.Atoi(m[2])
+		c, _ := strconv.Atoi(m[3])
+		return &ParseError{File: m[1], Line: l, Column: c, Message: m[4]}
+	}
+	if i := strings.Index(line, ": "); i > 0 {
+		return &ParseError{File: line[:i], Message: line[i+2:]}
+	}
+	if line == "" {
+		line = "protoc failed"
+	}
+	return &ParseError{File: filename, Message: line}
+}
+
+// validate checks that a set holds everything the comparison relies on, so
+// that Compare can report bad input instead of failing halfway through, and
+// returns the symbols of the set.
+func validate(set *descriptor.FileDescriptorSet) (*symbolTable, error) {
+	if set == nil {
+		return nil, &MalformedDescriptorError{Reason: "missing FileDescriptorSet"}
+	}
+	symbols := newSymbolTable(set)
+	for _, file := range set.File {
+		if file == nil {
+			return nil, &MalformedDescriptorError{Reason: "missing FileDescriptorProto"}
+		}
+		prefix := packageScope(file)
+		for _, ext := range file.Extension {
+			if err := validateField(ext, prefix, file, symbols); err != nil {
+				return nil, err
+			}
+		}
+		for _, message := range file.MessageType {
+			if err := validateMessage(message, prefix, file, symbols); err != nil {
+				return nil, err
+			}
+		}
+		for _, enum := range file.EnumType {
+			if err := validateEnum(enum, prefix, file); err != nil {
+				return nil, err
+			}
+		}
+		for _, service := range file.Service {
+			if service == nil || service.Name == nil {
+				return nil, &MalformedDescriptorError{File: file.GetName(), Element: prefix, Reason: "service without a name"}
+			}
+			for _, method := range service.Method {
+				if method == nil || method.Name == nil {
+					return nil, &MalformedDescriptorError{File: file.GetName(), Element: prefix + "." + service.GetName(), Reason: "method without a name"}
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+func validateMessage(d *descriptor.DescriptorProto, path string, file *descriptor.FileDescriptorProto, symbols *symbolTable) error {
+	if d == nil || d.Name == nil {
+		return &MalformedDescriptorError{File: file.GetName(), Element: path, Reason: "message without a name"}
+	}
+	path = path + "." + d.GetName()
+	for _, field := range d.Field {
+		if err := validateField(field, path, file, symbols); err != nil {
+			return err
+		}
+	}
+	for _, ext := range d.Extension {
+		if err := validateField(ext, path, file, symbols); err != nil {
+			return err
+		}
+	}
+	for _, r := range d.ExtensionRange {
+		if r == nil || r.Start == nil || r.End == nil {
+			return &MalformedDescriptorError{File: file.GetName(), Element: path, Reason: "extension range without start or end"}
+		}
+	}
+	for _, msg := range d.NestedType {
+		if err := validateMessage(msg, path, file, symbols); err != nil {
+			return err
+		}
+	}
+	for _, enum := range d.EnumType {
+		if err := validateEnum(enum, path, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateField(f *descriptor.FieldDescriptorProto, path string, file *descriptor.FileDescriptorProto, symbols *symbolTable) error {
+	if f == nil || f.Name == nil {
+		return &MalformedDescriptorError{File: file.GetName(), Element: path, Reason: "field without a name"}
+	}
+	element := path + "." + f.GetName()
+	switch {
+	case f.Number == nil:
+		return &MalformedDescriptorError{File: file.GetName(), Element: element, Reason: "field without a number"}
+	case f.Label == nil:
+		return &MalformedDescriptorError{File: file.GetName(), Element: element, Reason: "field without a label"}
+	case f.Type == nil:
+		return &MalformedDescriptorError{File: file.GetName(), Element: element, Reason: "field without a type"}
+	}
+	if f.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetType() == descriptor.FieldDescriptorProto_TYPE_GROUP {
+		if symbols.message(f.GetTypeName()) == nil {
+			return &UnresolvedTypeError{File: file.GetName(), Element: element, Type: f.GetTypeName()}
+		}
+	}
+	if f.GetType() == descriptor.FieldDescriptorProto_TYPE_ENUM && symbols.enum(f.GetTypeName()) == nil {
+		return &UnresolvedTypeError{File: file.GetName(), Element: element, Type: f.GetTypeName()}
+	}
+	if f.Extendee != nil && symbols.message(f.GetExtendee()) == nil {
+		return &UnresolvedTypeError{File: file.GetName(), Element: element, Type: f.GetExtendee()}
+	}
+	return nil
+}
+
+func validateEnum(enum *descriptor.EnumDescriptorProto, path string, file *descriptor.FileDescriptorProto) error {
+	if enum == nil || enum.Name == nil {
+		return &MalformedDescriptorError{File: file.GetName(), Element: path, Reason: "enum without a name"}
+	}
+	for _, value := range enum.Value {
+		if value == nil || value.Name == nil || value.Number == nil {
+			return &MalformedDescriptorError{File: file.GetName(), Element: path + "." + enum.GetName(), Reason: "enum value without a name or number"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strconv"
+	"strings"
+)
+
+func extensionRanges(d *descriptor.DescriptorProto) []numberRange {
+	var out []numberRange
+	for _, r := range d.ExtensionRange {
+		out = append(out, numberRange{r.GetStart(), r.GetEnd()})
+	}
+	return out
+}
+
+// fieldKind tells whether f is a field or an extension.
+func fieldKind(f *descriptor.FieldDescriptorProto) string {
+	if f.Extendee != nil {
+		return "extension"
+	}
+	return "field"
+}
+
+// compareConversion reports a field converted to an extension with the same
+// name and number, or an extension converted to a field. An extension of
+// another name reuses the number, which getChangesExtensionNumbers reports.
+// Changes of label and type are reported by compareFields like for any other
+// field.
+func compareConversion(val1, val2 *descriptor.FieldDescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	if fieldKind(val1) != fieldKind(val2) && val1.GetName() == val2.GetName() {
+		output.addWarning(ConvertedExtension, fieldKind(val1), fieldKind(val2), path, strconv.Itoa(int(val1.GetNumber())), "").at(c, val1, val2)
+	}
+	return output
+}
+
+// getChangesExtensionRanges reports extensions of the newer message using
+// numbers outside of its extension ranges, and numbers removed from the
+// extension ranges of the older message. Removing numbers used by an
+// extension of the older version gives an error, other numbers may still be
+// used by extensions declared outside of the compared files, which gives a
+// warning. Numbers taken over by a field are not reported.
+func getChangesExtensionRanges(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	for _, ext := range c.newer.extended[newer] {
+		if !isExtension(int(ext.GetNumber()), newer.ExtensionRange) {
+			output.addError(ExtensionOutOfRange, ext.GetName(), "", path, strconv.Itoa(int(ext.GetNumber())), "").at(c, ext, nil)
+		}
+	}
+	covered := extensionRanges(newer)
+	for _, val1 := range newer.Field {
+		covered = append(covered, numberRange{val1.GetNumber(), val1.GetNumber() + 1})
+	}
+	for _, r := range extensionRanges(older) {
+		for _, u := range uncovered(r, covered) {
+			var used []string
+			for _, ext := range c.older.extended[older] {
+				if ext.GetNumber() >= u.start && ext.GetNumber() < u.end {
+					used = append(used, ext.GetName())
+				}
+			}
+			if used != nil {
+				output.addError(RemovedExtensionRange, "", u.String(), path, "", ", used by "+strings.Join(used, ", "))
+			} else {
+				output.addWarning(RemovedExtensionRange, "", u.String(), path, "", ", extensions outside of the compared files may use them")
+			}
+		}
+	}
+	return output
+}
+
+// getChangesExtensionNumbers reports new extensions of the newer message
+// using a number that an extension of another name used in the older
+// version, or that a field of another name used in the older message. Old
+// data holding the previous element would be read as the new extension.
+func getChangesExtensionNumbers(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	for _, ext := range c.newer.extended[newer] {
+		name := c.newer.names[ext]
+		if c.older.extensions[name] != nil { //compared with itself like any other field
+			continue
+		}
+		for _, val2 := range c.older.extended[older] {
+			if val2.GetNumber() == ext.GetNumber() {
+				output.addError(ReusedExtensionNumber, name, c.older.names[val2], path, strconv.Itoa(int(ext.GetNumber())), "").breaks(ModeBackward).at(c, ext, val2)
+			}
+		}
+		for _, val2 := range older.Field {
+			if val2.GetNumber() == ext.GetNumber() && val2.GetName() != ext.GetName() { //same name is a conversion
+				output.addError(ReusedExtensionNumber, name, val2.GetName(), path, strconv.Itoa(int(ext.GetNumber())), "").breaks(ModeBackward).at(c, ext, val2)
+			}
+		}
+	}
+	return output
+}
+
+// duplicateExtensions reports extensions using the same number as another
+// extension of the same message, which can only be declared in files compiled
+// separately and fails once both are registered. Duplicates of the newer
+// version give an error, those of the older version a warning, since they are
+// not caused by the change.
+func duplicateExtensions(c Comparer) DifferenceList {
+	var output DifferenceList
+	var walk func(d *descriptor.DescriptorProto, path string, symbols *symbolTable, older bool)
+	walk = func(d *descriptor.DescriptorProto, path string, symbols *symbolTable, older bool) {
+		seen := make(map[int32]*descriptor.FieldDescriptorProto)
+		for _, ext := range symbols.extended[d] {
+			first, ok := seen[ext.GetNumber()]
+			if !ok {
+				seen[ext.GetNumber()] = ext
+				continue
+			}
+			number := strconv.Itoa(int(ext.GetNumber()))
+			var diff *Difference
+			if older {
+				diff = output.addWarning(DuplicateExtension, "", symbols.names[ext], path, number, ", already used by "+symbols.names[first]+" in the older version")
+				diff.at(c, nil, ext)
+			} else {
+				diff = output.addError(DuplicateExtension, symbols.names[ext], "", path, number, ", already used by "+symbols.names[first])
+				diff.at(c, ext, nil)
+			}
+			diff.File = c.files[ext].GetName()
+		}
+		for _, msg := range d.NestedType {
+			walk(msg, path+"."+msg.GetName(), symbols, older)
+		}
+	}
+	for _, file := range c.Newer.File {
+		for _, message := range file.MessageType {
+			walk(message, packageScope(file)+"."+message.GetName(), c.newer, false)
+		}
+	}
+	for _, file := range c.Older.File {
+		for _, message := range file.MessageType {
+			walk(message, packageScope(file)+"."+message.GetName(), c.older, true)
+		}
+	}
+	return output
+}
+
+// listExtensions lists the differences concerning extensions in Extension,
+// in addition to Error and Warning.
+func (d *DifferenceList) listExtensions() {
+	for _, list := range [][]Difference{d.Error, d.Warning} {
+		for _, val := range list {
+			switch val.Condition {
+			case ConvertedExtension, ExtensionOutOfRange, RemovedExtensionRange, DuplicateExtension, ReusedExtensionNumber:
+				d.Extension = append(d.Extension, val)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"github.com/gogo/protobuf/proto"
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+)
+
+// Field numbers of descriptor.proto additions that are missing from the
+// vendored descriptor package and therefore only appear in XXX_unrecognized.
+const (
+	fieldProto3Optional  = 17 // FieldDescriptorProto.proto3_optional
+	fieldFileFeatures    = 50 // FileOptions.features
+	fieldEnumFeatures    = 7  // EnumOptions.features
+	fieldFeatureEnumType = 2  // FeatureSet.enum_type
+)
+
+const featureEnumClosed = 2 // FeatureSet.EnumType.CLOSED
+
+// unrecognizedField returns the last occurrence of a field in the
+// unrecognized bytes of a descriptor, either as a varint value or as the
+// contents of a length delimited field.
+func unrecognizedField(raw []byte, field uint64) (value uint64, data []byte, ok bool) {
+	b := proto.NewBuffer(raw)
+	for {
+		key, err := b.DecodeVarint()
+		if err != nil {
+			return value, data, ok
+		}
+		var v uint64
+		var d []byte
+		switch key & 7 {
+		case proto.WireVarint:
+			v, err = b.DecodeVarint()
+		case proto.WireFixed64:
+			v, err = b.DecodeFixed64()
+		case proto.WireBytes:
+			d, err = b.DecodeRawBytes(false)
+		case proto.WireFixed32:
+			v, err = b.DecodeFixed32()
+		default:
+			return value, data, ok
+		}
+		if err != nil {
+			return value, data, ok
+		}
+		if key>>3 == field {
+			value, data, ok = v, d, true
+		}
+	}
+}
+
+// isProto3Optional reports whether a field was declared optional in a proto3
+// file, which protoc represents as a oneof holding only that field.
+func isProto3Optional(f *descriptor.FieldDescriptorProto) bool {
+	v, _, ok := unrecognizedField(f.XXX_unrecognized, fieldProto3Optional)
+	return ok && v != 0
+}
+
+// enumType returns the enum_type feature of a FeatureSet found in the
+// unrecognized bytes of an options message, or 0 if it is not set.
+func enumType(options []byte, field uint64) uint64 {
+	_, features, ok := unrecognizedField(options, field)
+	if !ok {
+		return 0
+	}
+	v, _, _ := unrecognizedField(features, fieldFeatureEnumType)
+	return v
+}
+
+// isOpenEnum reports whether an enum accepts unknown values. Enums are open
+// in proto3 and closed in proto2. Editions files default to open enums, which
+// the enum_type feature of the file or the enum itself can override.
+func isOpenEnum(enum *descriptor.EnumDescriptorProto, file *descriptor.FileDescriptorProto) bool {
+	switch syntax(file) {
+	case "proto2":
+		return false
+	case "proto3":
+		return true
+	}
+	var t uint64
+	if enum.Options != nil {
+		t = enumType(enum.Options.XXX_unrecognized, fieldEnumFeatures)
+	}
+	if t == 0 && file.Options != nil {
+		t = enumType(file.Options.XXX_unrecognized, fieldFileFeatures)
+	}
+	return t != featureEnumClosed
+}
@@ -0,0 +1,160 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadGitFile reads a schema like ReadFile, but as it was at a revision (a
+// tag, branch or commit) of the git repository containing filename, without
+// checking that revision out. Import paths inside the repository are resolved
+// within the same revision, import paths outside it are used as they are.
+func ReadGitFile(revision, filename string, importPaths ...string) (*descriptor.FileDescriptorSet, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(filepath.Dir(abs), nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSpace(string(out))
+	rel, err := relativePath(root, abs)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(filename) != ".proto" {
+		data, err := git(root, nil, "cat-file", "blob", revision+":"+rel)
+		if err != nil {
+			return nil, err
+		}
+		return ReadDescriptorSet(data)
+	}
+
+	dir, err := ioutil.TempDir("", "protocompat")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := exportProtos(root, revision, dir); err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(importPaths))
+	for i, path := range importPaths {
+		paths[i] = path
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if r, err := relativePath(root, abs); err == nil {
+			paths[i] = filepath.Join(dir, r)
+		}
+	}
+	return parseProto(filepath.Join(dir, rel), paths...)
+}
+
+// relativePath returns path relative to root, or an error if it lies outside root.
+func relativePath(root, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		path = filepath.Join(dir, filepath.Base(path))
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the repository %s", path, root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// exportProtos writes every .proto file of a revision into dir, reading them
+// all through a single git cat-file process.
+func exportProtos(root, revision, dir string) error {
+	out, err := git(root, nil, "ls-tree", "-r", "-z", "--name-only", revision)
+	if err != nil {
+		return err
+	}
+	var files []string
+	var request bytes.Buffer
+	for _, name := range strings.Split(string(out), "\x00") {
+		if strings.HasSuffix(name, ".proto") {
+			files = append(files, name)
+			request.WriteString(revision + ":" + name + "\n")
+		}
+	}
+	if files == nil {
+		return nil
+	}
+	out, err = git(root, &request, "cat-file", "--batch")
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(bytes.NewReader(out))
+	for _, name := range files {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("git cat-file: unexpected output %q", header)
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return err
+		}
+		content := make([]byte, size+1) // the content is followed by a newline
+		if _, err := io.ReadFull(r, content); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, content[:size], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func git(dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,75 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestReadGitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompat")
+	check(err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		check(os.MkdirAll(filepath.Dir(path), 0755))
+		check(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	commit := func() {
+		_, err := git(dir, nil, "add", "-A")
+		check(err)
+		_, err = git(dir, nil, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "schema")
+		check(err)
+	}
+	_, err = git(dir, nil, "init", "-q")
+	check(err)
+	write("proto/common/id.proto", "message Id {\n  required int64 value = 1;\n}\n")
+	write("proto/person.proto", "import \"common/id.proto\";\n\nmessage Person {\n  required Id id = 1;\n  optional string name = 2;\n}\n")
+	commit()
+	_, err = git(dir, nil, "tag", "v1")
+	check(err)
+	write("proto/common/id.proto", "message Id {\n  required int64 value = 1;\n  required string kind = 2;\n}\n")
+	write("proto/person.proto", "import \"common/id.proto\";\n\nmessage Person {\n  required Id id = 1;\n}\n")
+	commit()
+	write("proto/person.proto", "import \"common/id.proto\";\n\nmessage Person {\n  required Id id = 1;\n  required string email = 3;\n}\n")
+
+	file, include := filepath.Join(dir, "proto", "person.proto"), filepath.Join(dir, "proto")
+	newer, err := ReadFile(file, include)
+	check(err)
+	tests := []struct {
+		revision string
+		errors   int
+	}{
+		{"HEAD", 1},
+		{"v1", 2},
+	}
+	for _, test := range tests {
+		older, err := ReadGitFile(test.revision, file, include)
+		check(err)
+		c := Comparer{Newer: newer, Older: older}
+		d, err := c.Compare()
+		check(err)
+		if len(d.Error) != test.errors {
+			t.Error("Expected " + strconv.Itoa(test.errors) + " errors against " + test.revision + ", found " + strconv.Itoa(len(d.Error)))
+		}
+	}
+	if _, err := ReadGitFile("v2", file, include); err == nil {
+		t.Error("Expected an error for an unknown revision")
+	}
+}
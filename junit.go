@@ -0,0 +1,114 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	SystemOut string         `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// contains reports whether a difference at path belongs to the element at
+// element, which is the case for the element itself and everything below it.
+func contains(element, path string) bool {
+	if !strings.HasPrefix(path, element) {
+		return false
+	}
+	rest := path[len(element):]
+	return rest == "" || rest[0] == '.' || rest[0] == '['
+}
+
+// JUnit renders the differences as a JUnit XML report with one test case per
+// compared message, enum and service. Every error becomes a failure of the
+// innermost element containing it, and warnings, lossy and informational
+// differences are listed as its output, labelled with their severity.
+// Differences outside of any compared element, such as added or removed
+// messages, belong to a test case for their file.
+func (d *DifferenceList) JUnit() ([]byte, error) {
+	suite := junitTestSuite{Name: "protocompat"}
+	index := make(map[Element]int)
+	for _, e := range d.Compared {
+		if _, ok := index[e]; !ok {
+			index[e] = len(suite.Cases)
+			suite.Cases = append(suite.Cases, junitTestCase{Name: e.Kind + " " + e.Path, ClassName: e.File})
+		}
+	}
+	testCase := func(val Difference) *junitTestCase {
+		best, path := -1, ""
+		for _, e := range d.Compared {
+			if e.File == val.File && contains(e.Path, val.Path) && (best < 0 || len(e.Path) > len(path)) {
+				best, path = index[e], e.Path
+			}
+		}
+		if best < 0 {
+			e := Element{Kind: "file", File: val.File, Path: val.File}
+			if _, ok := index[e]; !ok {
+				index[e] = len(suite.Cases)
+				suite.Cases = append(suite.Cases, junitTestCase{Name: e.Kind + " " + e.Path, ClassName: e.File})
+			}
+			best = index[e]
+		}
+		return &suite.Cases[best]
+	}
+	for _, val := range d.Error {
+		t := testCase(val)
+		t.Failures = append(t.Failures, junitFailure{Message: val.String(), Type: val.Condition.String(), Text: val.RuleID + ": " + val.String()})
+	}
+	for _, val := range d.Warning {
+		t := testCase(val)
+		label := "WARNING "
+		if val.Severity == SeverityInfo {
+			label = "INFO "
+		} else if val.Severity == SeverityLossy {
+			label = "LOSSY "
+		}
+		t.SystemOut += label + val.RuleID + ": " + val.String() + "\n"
+	}
+	suite.Tests = len(suite.Cases)
+	for _, t := range suite.Cases {
+		if len(t.Failures) > 0 {
+			suite.Failures++
+		}
+	}
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
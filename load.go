@@ -0,0 +1,94 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ReadFile reads one version of a schema for a Comparer. Files ending in
+// .proto are parsed with protoc using importPaths, keeping source code info so
+// that differences can be located. Any other file is read as a
+// FileDescriptorSet, either binary as written by
+// protoc --descriptor_set_out --include_imports, or JSON encoded.
+func ReadFile(filename string, importPaths ...string) (*descriptor.FileDescriptorSet, error) {
+	if filepath.Ext(filename) == ".proto" {
+		return parseProto(filename, importPaths...)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ReadDescriptorSet(data)
+}
+
+// parseProto runs protoc on a .proto file and returns it along with its
+// imports, including source code info. It returns a ParseError if protoc
+// rejects the file.
+func parseProto(filename string, importPaths ...string) (*descriptor.FileDescriptorSet, error) {
+	out, err := ioutil.TempFile("", "protocompat")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+	args := []string{"--include_imports", "--include_source_info", "--descriptor_set_out=" + out.Name()}
+	for _, path := range importPaths {
+		args = append(args, "--proto_path="+path)
+	}
+	cmd := exec.Command("protoc", append(args, filename)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, parseError(filename, stderr.String())
+		}
+		return nil, fmt.Errorf("protoc: %v", err)
+	}
+	data, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptor.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// ReadDescriptorSet decodes a binary or JSON encoded FileDescriptorSet.
+func ReadDescriptorSet(data []byte) (*descriptor.FileDescriptorSet, error) {
+	set := &descriptor.FileDescriptorSet{}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		if err := u.Unmarshal(bytes.NewReader(trimmed), set); err != nil {
+			return nil, err
+		}
+		return set, nil
+	}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
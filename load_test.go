@@ -0,0 +1,65 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestReadDescriptorSet(t *testing.T) {
+	newer, err := ReadFile("./TestProtos/IntProtos/Changes/Original.proto", "./TestProtos/IntProtos/Changes")
+	check(err)
+	for _, file := range []string{"./TestProtos/IntProtos/Original.pb", "./TestProtos/IntProtos/Original.json"} {
+		older, err := ReadFile(file)
+		check(err)
+		c := Comparer{Newer: newer, Older: older}
+		d, err := c.Compare()
+		check(err)
+		if !d.IsCompatible() {
+			t.Error("Changes to integer types broke the compatibility when reading " + file)
+		}
+		if len(d.Warning) != 20 {
+			t.Error("Expected 20 warnings when reading " + file + ", found " + strconv.Itoa(len(d.Warning)))
+		}
+	}
+}
+
+func TestReadDescriptorSetInvalid(t *testing.T) {
+	if _, err := ReadDescriptorSet([]byte("{\"file\": 1}")); err == nil {
+		t.Error("Expected an error for malformed JSON")
+	}
+	if _, err := ReadDescriptorSet([]byte{0xff, 0xff}); err == nil {
+		t.Error("Expected an error for malformed binary data")
+	}
+}
+
+func TestReadFileParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompat")
+	check(err)
+	defer os.RemoveAll(dir)
+	check(ioutil.WriteFile(filepath.Join(dir, "broken.proto"), []byte("message Foo {\n  optional int32 = 1;\n}\n"), 0644))
+	_, err = ReadFile(filepath.Join(dir, "broken.proto"), dir)
+	e, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected a ParseError, found %v", err)
+	}
+	if e.Line != 2 || e.Message == "" {
+		t.Error("Expected a parse error on line 2, found " + e.Error())
+	}
+}
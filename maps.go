@@ -0,0 +1,112 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strconv"
+	"strings"
+)
+
+// isMapEntry reports whether d is the entry message protoc generates for a
+// map field.
+func isMapEntry(d *descriptor.DescriptorProto) bool {
+	return d != nil && d.GetOptions().GetMapEntry()
+}
+
+// mapEntry returns the entry message of a map field, or nil if f is not a map.
+func mapEntry(f *descriptor.FieldDescriptorProto, s *symbolTable) *descriptor.DescriptorProto {
+	if f.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+		return nil
+	}
+	d := s.message(f.GetTypeName())
+	if !isMapEntry(d) {
+		return nil
+	}
+	return d
+}
+
+func entryField(entry *descriptor.DescriptorProto, number int32) *descriptor.FieldDescriptorProto {
+	for _, field := range entry.Field {
+		if field.GetNumber() == number {
+			return field
+		}
+	}
+	return nil
+}
+
+// typeName renders the type of a field as in a .proto file.
+func typeName(f *descriptor.FieldDescriptorProto) string {
+	if f.GetTypeName() != "" {
+		return f.GetTypeName()
+	}
+	return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+}
+
+func mapType(f *descriptor.FieldDescriptorProto, entry *descriptor.DescriptorProto) string {
+	if entry == nil {
+		return strings.ToLower(strings.TrimPrefix(f.GetLabel().String(), "LABEL_")) + " " + typeName(f)
+	}
+	key, value := entryField(entry, 1), entryField(entry, 2)
+	if key == nil || value == nil {
+		return "map"
+	}
+	return "map<" + typeName(key) + ", " + typeName(value) + ">"
+}
+
+// compareMaps compares two fields of which at least one is a map. Keys and
+// values are reported at paths like .Foo.labels[key] instead of as fields of
+// the generated entry messages. A map converted from or to a repeated message
+// is compared with it field by field, while other conversions are left to the
+// changes of type and label.
+func compareMaps(val1, val2 *descriptor.FieldDescriptorProto, e1, e2 *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	number := strconv.Itoa(int(val1.GetNumber()))
+	if e1 == nil || e2 == nil {
+		other := val1
+		if e1 != nil {
+			other = val2
+		}
+		if other.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED || other.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+			return output
+		}
+		output.addWarning(ConvertedMap, mapType(val1, e1), mapType(val2, e2), path, number, ", this is only wire compatible if the message has a matching key field 1 and value field 2")
+		d1, d2 := c.newer.message(val1.GetTypeName()), c.older.message(val2.GetTypeName())
+		if d1 != nil && d2 != nil {
+			output.merge(getChangesFieldDP(d1, d2, path+"."+val1.GetName(), c))
+		}
+		return output
+	}
+	output.merge(compareMapEntry(entryField(e1, 1), entryField(e2, 1), ChangedMapKey, path+"."+val1.GetName()+"[key]", number, c))
+	output.merge(compareMapEntry(entryField(e1, 2), entryField(e2, 2), ChangedMapValue, path+"."+val1.GetName()+"[value]", number, c))
+	return output
+}
+
+func compareMapEntry(val1, val2 *descriptor.FieldDescriptorProto, condition Condition, path, number string, c Comparer) DifferenceList {
+	var output DifferenceList
+	if val1 == nil || val2 == nil {
+		return output
+	}
+	if val1.GetType() != val2.GetType() {
+		output.addTypeChange(condition, val1.GetType(), val2.GetType(), path, number)
+	} else if val1.GetTypeName() != val2.GetTypeName() {
+		output.addWarning(condition, val1.GetTypeName(), val2.GetTypeName(), path, number, ", compare the value types field by field")
+		d1, d2 := c.newer.message(val1.GetTypeName()), c.older.message(val2.GetTypeName())
+		if d1 != nil && d2 != nil {
+			c.pairs.reach(d1, d2, val1.GetTypeName(), path)
+		}
+	}
+	return output
+}
@@ -0,0 +1,93 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Mode is a direction in which data is read across versions. A Comparer
+// reports an error only if it breaks compatibility in its mode, and a
+// Difference tells in which modes it breaks compatibility.
+type Mode int
+
+const (
+	// ModeBackward requires newer readers to read data written with the
+	// older version, such as when readers are deployed before writers.
+	ModeBackward Mode = 1 << iota
+	// ModeForward requires older readers to read data written with the
+	// newer version, such as when writers are deployed before readers.
+	ModeForward
+	// ModeFull requires both, and is used by a Comparer without a mode.
+	ModeFull = ModeBackward | ModeForward
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeBackward:
+		return "backward"
+	case ModeForward:
+		return "forward"
+	case ModeFull:
+		return "full"
+	}
+	return "none"
+}
+
+// MarshalText encodes a mode as "backward", "forward" or "full".
+func (m Mode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a mode encoded by MarshalText.
+func (m *Mode) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "backward":
+		*m = ModeBackward
+	case "forward":
+		*m = ModeForward
+	case "full":
+		*m = ModeFull
+	default:
+		return errors.New("unknown mode " + strconv.Quote(string(text)))
+	}
+	return nil
+}
+
+// breaks records in which modes an error breaks compatibility, if it does
+// not break both.
+func (d *Difference) breaks(m Mode) *Difference {
+	d.Breaks = m
+	return d
+}
+
+// inMode turns the errors that do not break compatibility in mode into
+// warnings.
+func (d *DifferenceList) inMode(mode Mode) {
+	if mode == 0 {
+		mode = ModeFull
+	}
+	var errs []Difference
+	for _, val := range d.Error {
+		if val.Breaks&mode != 0 {
+			errs = append(errs, val)
+		} else {
+			val.Severity = SeverityWarning
+			d.Warning = append(d.Warning, val)
+		}
+	}
+	d.Error = errs
+}
@@ -0,0 +1,117 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strconv"
+	"strings"
+)
+
+// oneofs maps the number of every field in a real oneof to the name of the
+// oneof. Synthetic oneofs of proto3 optional fields are left out, they do not
+// make fields mutually exclusive.
+func oneofs(d *descriptor.DescriptorProto) map[int32]string {
+	out := make(map[int32]string)
+	for _, field := range d.Field {
+		if field.OneofIndex == nil || isProto3Optional(field) {
+			continue
+		}
+		i := int(field.GetOneofIndex())
+		if i < len(d.OneofDecl) {
+			out[field.GetNumber()] = d.OneofDecl[i].GetName()
+		}
+	}
+	return out
+}
+
+// mates returns the fields of numbers that share a real oneof with field.
+func mates(field int32, members map[int32]string, numbers []int32) map[int32]bool {
+	out := make(map[int32]bool)
+	name, ok := members[field]
+	if !ok {
+		return out
+	}
+	for _, n := range numbers {
+		if n != field && members[n] == name {
+			out[n] = true
+		}
+	}
+	return out
+}
+
+// getChangesOneofs compares which fields existing in both versions are
+// mutually exclusive. A field gaining oneof mates loses data written by old
+// code that set them together, a field losing mates loses data written by new
+// code when it is read by old code.
+func getChangesOneofs(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	names := make(map[int32]string)
+	fields := make(map[int32][2]*descriptor.FieldDescriptorProto)
+	var numbers []int32
+	for _, val1 := range newer.Field {
+		for _, val2 := range older.Field {
+			if val1.GetNumber() == val2.GetNumber() {
+				names[val1.GetNumber()] = val1.GetName()
+				fields[val1.GetNumber()] = [2]*descriptor.FieldDescriptorProto{val1, val2}
+				numbers = append(numbers, val1.GetNumber())
+			}
+		}
+	}
+	newOneofs, oldOneofs := oneofs(newer), oneofs(older)
+	for _, n := range numbers {
+		newMates, oldMates := mates(n, newOneofs, numbers), mates(n, oldOneofs, numbers)
+		var gained, lost []string
+		for _, m := range numbers {
+			if newMates[m] && !oldMates[m] {
+				gained = append(gained, names[m])
+			}
+			if oldMates[m] && !newMates[m] {
+				lost = append(lost, names[m])
+			}
+		}
+		if gained == nil && lost == nil {
+			continue
+		}
+		message := ""
+		var mode Mode
+		if gained != nil {
+			message += ", old writers may set it together with " + strings.Join(gained, ", ") + " and new readers only keep the last one"
+			mode |= ModeBackward
+		}
+		if lost != nil {
+			message += ", new writers may set it together with " + strings.Join(lost, ", ") + " and old readers only keep the last one"
+			mode |= ModeForward
+		}
+		newName, inNew := newOneofs[n]
+		oldName, inOld := oldOneofs[n]
+		qualifier := strconv.Itoa(int(n))
+		var d *Difference
+		switch {
+		case !inOld:
+			d = output.addError(MovedIntoOneof, newName, "", path, qualifier, message)
+		case !inNew:
+			d = output.addError(MovedOutOfOneof, "", oldName, path, qualifier, message)
+		case newName != oldName:
+			d = output.addError(MovedBetweenOneofs, newName, oldName, path, qualifier, message)
+		case lost != nil:
+			d = output.addError(SplitOneof, newName, oldName, path, qualifier, message)
+		default:
+			d = output.addError(MergedOneof, newName, oldName, path, qualifier, message)
+		}
+		d.breaks(mode).at(c, fields[n][0], fields[n][1])
+	}
+	return output
+}
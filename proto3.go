@@ -0,0 +1,139 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strconv"
+)
+
+// indexFiles maps every message, enum, service and field (including
+// extensions) of the given sets to the file declaring it, so that syntax
+// dependent rules can be applied to types reached through a TypeName.
+func indexFiles(sets ...*descriptor.FileDescriptorSet) map[interface{}]*descriptor.FileDescriptorProto {
+	files := make(map[interface{}]*descriptor.FileDescriptorProto)
+	for _, set := range sets {
+		for _, file := range set.File {
+			for _, enum := range file.EnumType {
+				files[enum] = file
+			}
+			for _, ext := range file.Extension {
+				files[ext] = file
+			}
+			for _, service := range file.Service {
+				files[service] = file
+			}
+			for _, message := range file.MessageType {
+				indexMessage(message, file, files)
+			}
+		}
+	}
+	return files
+}
+
+func indexMessage(d *descriptor.DescriptorProto, file *descriptor.FileDescriptorProto, files map[interface{}]*descriptor.FileDescriptorProto) {
+	files[d] = file
+	for _, field := range d.Field {
+		files[field] = file
+	}
+	for _, ext := range d.Extension {
+		files[ext] = file
+	}
+	for _, enum := range d.EnumType {
+		files[enum] = file
+	}
+	for _, msg := range d.NestedType {
+		indexMessage(msg, file, files)
+	}
+}
+
+// syntax returns the syntax of a file, protoc leaves it empty for proto2.
+func syntax(f *descriptor.FileDescriptorProto) string {
+	if f.GetSyntax() == "" {
+		return "proto2"
+	}
+	return f.GetSyntax()
+}
+
+func isProto3(f *descriptor.FileDescriptorProto) bool {
+	return f != nil && f.GetSyntax() == "proto3"
+}
+
+// hasPresence reports whether a singular field distinguishes between unset
+// and set to its zero value. In proto3 only message fields and fields in a
+// oneof do, which includes optional fields through their synthetic oneof.
+func hasPresence(f *descriptor.FieldDescriptorProto, proto3 bool) bool {
+	if !proto3 || f.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE || f.GetType() == descriptor.FieldDescriptorProto_TYPE_GROUP {
+		return true
+	}
+	return f.OneofIndex != nil
+}
+
+func isPackable(t descriptor.FieldDescriptorProto_Type) bool {
+	switch t {
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES, descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		return false
+	}
+	return true
+}
+
+// isPacked reports whether a repeated field is written using packed
+// encoding, which is the default for scalar fields in proto3.
+func isPacked(f *descriptor.FieldDescriptorProto, proto3 bool) bool {
+	if f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED || !isPackable(f.GetType()) {
+		return false
+	}
+	if f.Options != nil && f.Options.Packed != nil {
+		return f.Options.GetPacked()
+	}
+	return proto3
+}
+
+func presence(explicit bool) string {
+	if explicit {
+		return "explicit presence"
+	}
+	return "implicit presence"
+}
+
+func packing(packed bool) string {
+	if packed {
+		return "packed"
+	}
+	return "unpacked"
+}
+
+func compareProto3Fields(val1, val2 *descriptor.FieldDescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	newer3, older3 := isProto3(c.files[val1]), isProto3(c.files[val2])
+	repeated := descriptor.FieldDescriptorProto_LABEL_REPEATED
+	if val1.GetLabel() != repeated && val2.GetLabel() != repeated {
+		p1, p2 := hasPresence(val1, newer3), hasPresence(val2, older3)
+		if p1 != p2 {
+			message := ""
+			if !p1 {
+				message = ", zero values are no longer sent and cannot be told apart from unset fields"
+			}
+			output.addWarning(ChangedPresence, presence(p1), presence(p2), path, strconv.Itoa(int(val1.GetNumber())), message)
+		}
+	}
+	if val1.GetLabel() == repeated && val2.GetLabel() == repeated && isPackable(val1.GetType()) && isPackable(val2.GetType()) {
+		p1, p2 := isPacked(val1, newer3), isPacked(val2, older3)
+		if p1 != p2 {
+			output.addWarning(ChangedPacked, packing(p1), packing(p2), path, strconv.Itoa(int(val1.GetNumber())), ", parsers older than protobuf 2.3 cannot read the new encoding")
+		}
+	}
+	return output
+}
@@ -0,0 +1,255 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strings"
+)
+
+// renameThreshold is the similarity from which a removed and an added
+// message or enum are taken to be the same one under a new name.
+const renameThreshold = 0.75
+
+// fieldSimilarity scores how alike the fields of two messages are. Every
+// number used by either message counts 1 if both use it with the same type,
+// 0.5 if both use it with different types and 0 otherwise, and the score is
+// the average over all numbers.
+func fieldSimilarity(newer, older *descriptor.DescriptorProto) float64 {
+	numbers := make(map[int32]bool)
+	score := 0.0
+	for _, val1 := range newer.Field {
+		numbers[val1.GetNumber()] = true
+		for _, val2 := range older.Field {
+			if val1.GetNumber() == val2.GetNumber() {
+				if val1.GetType() == val2.GetType() {
+					score += 1
+				} else {
+					score += 0.5
+				}
+			}
+		}
+	}
+	for _, val2 := range older.Field {
+		numbers[val2.GetNumber()] = true
+	}
+	if len(numbers) == 0 { //empty messages tell nothing about each other
+		return 0
+	}
+	return score / float64(len(numbers))
+}
+
+// valueSimilarity scores how alike the values of two enums are, like
+// fieldSimilarity does for messages, with a number counting 1 if both enums
+// give it the same name and 0.5 if they give it different names.
+func valueSimilarity(newer, older *descriptor.EnumDescriptorProto) float64 {
+	numbers := make(map[int32]bool)
+	score := 0.0
+	for _, val1 := range newer.Value {
+		if numbers[val1.GetNumber()] { //aliases count once
+			continue
+		}
+		numbers[val1.GetNumber()] = true
+		if names := enumNames(older.Value, val1.GetNumber()); len(names) > 0 {
+			if sameNames(enumNames(newer.Value, val1.GetNumber()), names) {
+				score += 1
+			} else {
+				score += 0.5
+			}
+		}
+	}
+	for _, val2 := range older.Value {
+		numbers[val2.GetNumber()] = true
+	}
+	if len(numbers) == 0 {
+		return 0
+	}
+	return score / float64(len(numbers))
+}
+
+// pairRenames pairs each of n added elements, in order, with the most similar
+// of m removed ones that is not paired yet, if they are similar enough. It
+// returns the index of the removed element for every paired added one.
+func pairRenames(n, m int, similarity func(i, j int) float64) map[int]int {
+	pairs := make(map[int]int)
+	taken := make(map[int]bool)
+	for i := 0; i < n; i++ {
+		best, score := -1, 0.0
+		for j := 0; j < m; j++ {
+			if taken[j] {
+				continue
+			}
+			if s := similarity(i, j); s >= renameThreshold && s > score {
+				best, score = j, s
+			}
+		}
+		if best >= 0 {
+			pairs[i] = best
+			taken[best] = true
+		}
+	}
+	return pairs
+}
+
+// renamedMessages maps every added message that is a renamed removed one to
+// the removed message.
+func renamedMessages(added, removed []*descriptor.DescriptorProto) map[*descriptor.DescriptorProto]*descriptor.DescriptorProto {
+	renamed := make(map[*descriptor.DescriptorProto]*descriptor.DescriptorProto)
+	for i, j := range pairRenames(len(added), len(removed), func(i, j int) float64 { return fieldSimilarity(added[i], removed[j]) }) {
+		renamed[added[i]] = removed[j]
+	}
+	return renamed
+}
+
+// renamedEnums maps every added enum that is a renamed removed one to the
+// removed enum.
+func renamedEnums(added, removed []*descriptor.EnumDescriptorProto) map[*descriptor.EnumDescriptorProto]*descriptor.EnumDescriptorProto {
+	renamed := make(map[*descriptor.EnumDescriptorProto]*descriptor.EnumDescriptorProto)
+	for i, j := range pairRenames(len(added), len(removed), func(i, j int) float64 { return valueSimilarity(added[i], removed[j]) }) {
+		renamed[added[i]] = removed[j]
+	}
+	return renamed
+}
+
+// topLevelRenames pairs the top-level messages and enums that only the newer
+// version declares with the ones of the same package that only the older
+// version declares, and maps each of a renamed pair to the other.
+func topLevelRenames(c Comparer) map[interface{}]interface{} {
+	addedMessages := make(map[string][]*descriptor.DescriptorProto)
+	removedMessages := make(map[string][]*descriptor.DescriptorProto)
+	addedEnums := make(map[string][]*descriptor.EnumDescriptorProto)
+	removedEnums := make(map[string][]*descriptor.EnumDescriptorProto)
+	for _, file := range c.Newer.File {
+		scope := packageScope(file)
+		for _, val := range file.MessageType {
+			if c.older.messages[scope+"."+val.GetName()] == nil {
+				addedMessages[scope] = append(addedMessages[scope], val)
+			}
+		}
+		for _, val := range file.EnumType {
+			if c.older.enums[scope+"."+val.GetName()] == nil {
+				addedEnums[scope] = append(addedEnums[scope], val)
+			}
+		}
+	}
+	for _, file := range c.Older.File {
+		scope := packageScope(file)
+		for _, val := range file.MessageType {
+			if c.newer.messages[scope+"."+val.GetName()] == nil {
+				removedMessages[scope] = append(removedMessages[scope], val)
+			}
+		}
+		for _, val := range file.EnumType {
+			if c.newer.enums[scope+"."+val.GetName()] == nil {
+				removedEnums[scope] = append(removedEnums[scope], val)
+			}
+		}
+	}
+	renamed := make(map[interface{}]interface{})
+	for scope, added := range addedMessages {
+		for val1, val2 := range renamedMessages(added, removedMessages[scope]) {
+			renamed[val1], renamed[val2] = val2, val1
+		}
+	}
+	for scope, added := range addedEnums {
+		for val1, val2 := range renamedEnums(added, removedEnums[scope]) {
+			renamed[val1], renamed[val2] = val2, val1
+		}
+	}
+	return renamed
+}
+
+// renamedTypes tells whether the newer and older types a field refers to are
+// a renamed pair, which RenamedMessage or RenamedEnum already reports. Nested
+// types are paired among the nested types of their enclosing messages, the
+// way getChangesDP and getChangesEDP pair them.
+func renamedTypes(newName, oldName string, c Comparer) bool {
+	newName, oldName = qualify(newName), qualify(oldName)
+	p1, p2 := c.newer.message(newName[:strings.LastIndex(newName, ".")]), c.older.message(oldName[:strings.LastIndex(oldName, ".")])
+	if d1, d2 := c.newer.message(newName), c.older.message(oldName); d1 != nil && d2 != nil {
+		if p1 == nil || p2 == nil {
+			return c.renamed[d1] == d2
+		}
+		var added, removed []*descriptor.DescriptorProto
+		for _, val := range p1.NestedType {
+			if messageNamed(p2.NestedType, val.GetName()) == nil {
+				added = append(added, val)
+			}
+		}
+		for _, val := range p2.NestedType {
+			if messageNamed(p1.NestedType, val.GetName()) == nil {
+				removed = append(removed, val)
+			}
+		}
+		return renamedMessages(added, removed)[d1] == d2
+	}
+	if e1, e2 := c.newer.enum(newName), c.older.enum(oldName); e1 != nil && e2 != nil {
+		if p1 == nil || p2 == nil {
+			return c.renamed[e1] == e2
+		}
+		var added, removed []*descriptor.EnumDescriptorProto
+		for _, val := range p1.EnumType {
+			if enumNamed(p2.EnumType, val.GetName()) == nil {
+				added = append(added, val)
+			}
+		}
+		for _, val := range p2.EnumType {
+			if enumNamed(p1.EnumType, val.GetName()) == nil {
+				removed = append(removed, val)
+			}
+		}
+		return renamedEnums(added, removed)[e1] == e2
+	}
+	return false
+}
+
+func messageNamed(messages []*descriptor.DescriptorProto, name string) *descriptor.DescriptorProto {
+	for _, val := range messages {
+		if val.GetName() == name {
+			return val
+		}
+	}
+	return nil
+}
+
+func enumNamed(enums []*descriptor.EnumDescriptorProto, name string) *descriptor.EnumDescriptorProto {
+	for _, val := range enums {
+		if val.GetName() == name {
+			return val
+		}
+	}
+	return nil
+}
+
+// compareRenamedMessages reports that older was renamed to newer and compares
+// them like messages of the same name.
+func compareRenamedMessages(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	output.addWarning(RenamedMessage, path+"."+newer.GetName(), path+"."+older.GetName(), path+"."+newer.GetName(), "", "").at(c, newer, older)
+	output.addCompared("message", path+"."+newer.GetName())
+	c.pairs.renamed(newer, older)
+	output.merge(compareMessages(newer, older, path+"."+newer.GetName(), c))
+	return output
+}
+
+// compareRenamedEnums reports that older was renamed to newer and compares
+// them like enums of the same name.
+func compareRenamedEnums(newer, older *descriptor.EnumDescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	output.addWarning(RenamedEnum, path+"."+newer.GetName(), path+"."+older.GetName(), path+"."+newer.GetName(), "", "").at(c, newer, older)
+	output.addCompared("enum", path+"."+newer.GetName())
+	output.merge(compareEnums(newer, older, path+"."+newer.GetName(), c))
+	return output
+}
@@ -0,0 +1,127 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxFieldNumber = 536870911
+
+// numberRange is a range of field numbers, including start and excluding end
+// like DescriptorProto.ReservedRange.
+type numberRange struct {
+	start, end int32
+}
+
+func (r numberRange) String() string {
+	if r.end-r.start == 1 {
+		return strconv.Itoa(int(r.start))
+	}
+	if r.end > maxFieldNumber {
+		return strconv.Itoa(int(r.start)) + " to max"
+	}
+	return strconv.Itoa(int(r.start)) + " to " + strconv.Itoa(int(r.end-1))
+}
+
+func reservedRanges(d *descriptor.DescriptorProto) []numberRange {
+	var out []numberRange
+	for _, r := range d.ReservedRange {
+		out = append(out, numberRange{r.GetStart(), r.GetEnd()})
+	}
+	return out
+}
+
+func isReservedNumber(number int32, d *descriptor.DescriptorProto) bool {
+	for _, r := range d.ReservedRange {
+		if number >= r.GetStart() && number < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func isReservedName(name string, d *descriptor.DescriptorProto) bool {
+	for _, reserved := range d.ReservedName {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// uncovered returns the parts of r that are not part of any of covered.
+func uncovered(r numberRange, covered []numberRange) []numberRange {
+	sort.Slice(covered, func(i, j int) bool { return covered[i].start < covered[j].start })
+	var out []numberRange
+	cur := r.start
+	for _, c := range covered {
+		if c.end <= cur {
+			continue
+		}
+		if c.start >= r.end {
+			break
+		}
+		if c.start > cur {
+			out = append(out, numberRange{cur, c.start})
+		}
+		cur = c.end
+	}
+	if cur < r.end {
+		out = append(out, numberRange{cur, r.end})
+	}
+	return out
+}
+
+// getChangesReserved reports fields reusing numbers or names reserved by the
+// older message, and reservations dropped by the newer message. Reservations
+// taken over by a field are only reported as reused.
+func getChangesReserved(newer, older *descriptor.DescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	covered := reservedRanges(newer)
+	for _, val1 := range newer.Field {
+		if isReservedNumber(val1.GetNumber(), older) {
+			output.addError(ReusedReservedNumber, val1.GetName(), "", path, strconv.Itoa(int(val1.GetNumber())), "").breaks(ModeBackward).at(c, val1, nil)
+		}
+		if isReservedName(val1.GetName(), older) {
+			output.addError(ReusedReservedName, strconv.Itoa(int(val1.GetNumber())), "", path, val1.GetName(), "").breaks(ModeBackward).at(c, val1, nil)
+		}
+		covered = append(covered, numberRange{val1.GetNumber(), val1.GetNumber() + 1})
+	}
+	for _, r := range reservedRanges(older) {
+		var removed []string
+		for _, u := range uncovered(r, covered) {
+			removed = append(removed, u.String())
+		}
+		if removed != nil {
+			output.addError(RemovedReservedNumber, "", strings.Join(removed, ", "), path, "", "").at(c, newer, older)
+		}
+	}
+	for _, name := range older.ReservedName {
+		used := false
+		for _, val1 := range newer.Field {
+			if val1.GetName() == name {
+				used = true
+			}
+		}
+		if !used && !isReservedName(name, newer) {
+			output.addError(RemovedReservedName, "", name, path, "", "").at(c, newer, older)
+		}
+	}
+	return output
+}
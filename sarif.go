@@ -0,0 +1,122 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	"encoding/json"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+	Region *sarifRegion `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+// level returns the SARIF level of a difference. Added, removed and moved
+// files, messages and enums are reported as notes, since they are not
+// violations of a rule by themselves.
+func (d *Difference) level() string {
+	if d.Severity == SeverityError {
+		return "error"
+	}
+	if d.Severity == SeverityInfo || d.Condition == NonFieldIncompatibility {
+		return "note"
+	}
+	return "warning"
+}
+
+// SARIF renders the differences as a SARIF 2.1.0 log for code scanning tools.
+// Every condition is described as a rule, and every difference becomes a
+// result located at its NewLocation, or in its File if that is unknown. File
+// names should be paths the consumer can resolve, such as ones relative to
+// the repository root.
+func (d *DifferenceList) SARIF() ([]byte, error) {
+	driver := sarifDriver{Name: "protocompat", InformationURI: "https://github.com/igfe/compatibility"}
+	index := make(map[Condition]int)
+	for i, c := range Conditions() {
+		index[c] = i
+		driver.Rules = append(driver.Rules, sarifRule{ID: c.RuleID(), Name: c.String(), ShortDescription: sarifMessage{c.String()}, FullDescription: sarifMessage{c.Explain()}})
+	}
+	run := sarifRun{Tool: sarifTool{driver}, Results: []sarifResult{}}
+	for _, list := range [][]Difference{d.Error, d.Warning} {
+		for _, val := range list {
+			result := sarifResult{RuleID: val.RuleID, RuleIndex: index[val.Condition], Level: val.level(), Message: sarifMessage{val.text()}}
+			var location sarifLocation
+			if val.NewLocation != nil {
+				location.PhysicalLocation.ArtifactLocation.URI = val.NewLocation.File
+				location.PhysicalLocation.Region = &sarifRegion{val.NewLocation.Line, val.NewLocation.Column}
+			} else {
+				location.PhysicalLocation.ArtifactLocation.URI = val.File
+			}
+			if location.PhysicalLocation.ArtifactLocation.URI != "" {
+				result.Locations = append(result.Locations, location)
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+	return json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}}, "", "  ")
+}
@@ -0,0 +1,102 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+)
+
+func getChangesSDP(newer, older []*descriptor.ServiceDescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	for _, val1 := range newer {
+		exist := false
+		for _, val2 := range older {
+			if val1.GetName() == val2.GetName() {
+				exist = true
+				output.addCompared("service", path+"."+val1.GetName())
+				output.merge(getChangesMDP(val1.Method, val2.Method, path+"."+val1.GetName(), c).at(c, val1, val2))
+			}
+		}
+		if !exist {
+			output.addWarning(NonFieldIncompatibility, "", "", path+"."+val1.GetName(), val1.GetName(), "Added service "+val1.GetName()+" in "+path).at(c, val1, nil)
+		}
+	}
+	for _, val1 := range older {
+		exist := false
+		for _, val2 := range newer {
+			if val1.GetName() == val2.GetName() {
+				exist = true
+			}
+		}
+		if !exist {
+			output.addError(RemovedService, "", "", path, val1.GetName(), "").breaks(ModeBackward).at(c, nil, val1) //new servers cannot serve old clients
+		}
+	}
+	return output
+}
+
+func getChangesMDP(newer, older []*descriptor.MethodDescriptorProto, path string, c Comparer) DifferenceList {
+	var output DifferenceList
+	for _, val1 := range newer {
+		exist := false
+		for _, val2 := range older {
+			if val1.GetName() == val2.GetName() {
+				exist = true
+				output.merge(compareMethods(val1, val2, path).at(c, val1, val2))
+			}
+		}
+		if !exist {
+			output.addWarning(NonFieldIncompatibility, "", "", path+"."+val1.GetName(), val1.GetName(), "Added method "+val1.GetName()+" in "+path).at(c, val1, nil)
+		}
+	}
+	for _, val1 := range older {
+		exist := false
+		for _, val2 := range newer {
+			if val1.GetName() == val2.GetName() {
+				exist = true
+			}
+		}
+		if !exist {
+			output.addError(RemovedMethod, "", "", path, val1.GetName(), "").breaks(ModeBackward).at(c, nil, val1)
+		}
+	}
+	return output
+}
+
+func compareMethods(val1, val2 *descriptor.MethodDescriptorProto, path string) DifferenceList {
+	var output DifferenceList
+	if val1.GetInputType() != val2.GetInputType() {
+		output.addError(ChangedMethodInputType, val1.GetInputType(), val2.GetInputType(), path, val1.GetName(), "")
+	}
+	if val1.GetOutputType() != val2.GetOutputType() {
+		output.addError(ChangedMethodOutputType, val1.GetOutputType(), val2.GetOutputType(), path, val1.GetName(), "")
+	}
+	if val1.GetClientStreaming() != val2.GetClientStreaming() || val1.GetServerStreaming() != val2.GetServerStreaming() {
+		output.addError(ChangedStreaming, signature(val1), signature(val2), path, val1.GetName(), "")
+	}
+	return output
+}
+
+// signature renders the request and response of a method as in a .proto file.
+func signature(m *descriptor.MethodDescriptorProto) string {
+	in, out := m.GetInputType(), m.GetOutputType()
+	if m.GetClientStreaming() {
+		in = "stream " + in
+	}
+	if m.GetServerStreaming() {
+		out = "stream " + out
+	}
+	return "(" + in + ") returns (" + out + ")"
+}
@@ -0,0 +1,151 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strconv"
+	"strings"
+)
+
+// Field numbers of descriptor.proto, as used in source code info paths.
+const (
+	fieldFileMessageType   = 4  // FileDescriptorProto.message_type
+	fieldFileEnumType      = 5  // FileDescriptorProto.enum_type
+	fieldFileService       = 6  // FileDescriptorProto.service
+	fieldFileExtension     = 7  // FileDescriptorProto.extension
+	fieldFileSyntax        = 12 // FileDescriptorProto.syntax
+	fieldMessageField      = 2  // DescriptorProto.field
+	fieldMessageNestedType = 3  // DescriptorProto.nested_type
+	fieldMessageEnumType   = 4  // DescriptorProto.enum_type
+	fieldMessageExtension  = 6  // DescriptorProto.extension
+	fieldEnumValue         = 2  // EnumDescriptorProto.value
+	fieldServiceMethod     = 2  // ServiceDescriptorProto.method
+)
+
+// Location is a position in a .proto file, lines and columns start at 1.
+type Location struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// String returns the location as file.proto:12:3.
+func (l Location) String() string {
+	return l.File + ":" + strconv.Itoa(l.Line) + ":" + strconv.Itoa(l.Column)
+}
+
+// indexLocations maps every file, message, enum, enum value, field, service
+// and method of the given sets to where it is declared. Files parsed without
+// source code info are left out.
+func indexLocations(sets ...*descriptor.FileDescriptorSet) map[interface{}]*Location {
+	locations := make(map[interface{}]*Location)
+	for _, set := range sets {
+		for _, file := range set.File {
+			spans := make(map[string][]int32)
+			for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+				key := pathKey(loc.Path)
+				if _, ok := spans[key]; !ok {
+					spans[key] = loc.Span
+				}
+			}
+			if len(spans) == 0 {
+				continue
+			}
+			add := func(element interface{}, path []int32) {
+				if span := spans[pathKey(path)]; len(span) >= 2 {
+					locations[element] = &Location{file.GetName(), int(span[0]) + 1, int(span[1]) + 1}
+				}
+			}
+			add(file, nil)
+			add(file, []int32{fieldFileSyntax})
+			for i, enum := range file.EnumType {
+				indexEnumLocations(enum, []int32{fieldFileEnumType, int32(i)}, add)
+			}
+			for i, ext := range file.Extension {
+				add(ext, []int32{fieldFileExtension, int32(i)})
+			}
+			for i, message := range file.MessageType {
+				indexMessageLocations(message, []int32{fieldFileMessageType, int32(i)}, add)
+			}
+			for i, service := range file.Service {
+				path := []int32{fieldFileService, int32(i)}
+				add(service, path)
+				for j, method := range service.Method {
+					add(method, child(path, fieldServiceMethod, j))
+				}
+			}
+		}
+	}
+	return locations
+}
+
+func indexMessageLocations(d *descriptor.DescriptorProto, path []int32, add func(interface{}, []int32)) {
+	add(d, path)
+	for i, field := range d.Field {
+		add(field, child(path, fieldMessageField, i))
+	}
+	for i, ext := range d.Extension {
+		add(ext, child(path, fieldMessageExtension, i))
+	}
+	for i, enum := range d.EnumType {
+		indexEnumLocations(enum, child(path, fieldMessageEnumType, i), add)
+	}
+	for i, msg := range d.NestedType {
+		indexMessageLocations(msg, child(path, fieldMessageNestedType, i), add)
+	}
+}
+
+func indexEnumLocations(enum *descriptor.EnumDescriptorProto, path []int32, add func(interface{}, []int32)) {
+	add(enum, path)
+	for i, value := range enum.Value {
+		add(value, child(path, fieldEnumValue, i))
+	}
+}
+
+// child returns the path of the index-th element of a repeated field below path.
+func child(path []int32, field int32, index int) []int32 {
+	out := make([]int32, len(path), len(path)+2)
+	copy(out, path)
+	return append(out, field, int32(index))
+}
+
+func pathKey(path []int32) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = strconv.Itoa(int(p))
+	}
+	return strings.Join(parts, ".")
+}
+
+// at sets the locations of a difference to those of the newer and older
+// version of the element it was found in, either of which may be nil.
+func (d *Difference) at(c Comparer, newer, older interface{}) {
+	d.NewLocation = c.locations[newer]
+	d.OldLocation = c.locations[older]
+}
+
+// at locates every difference that has no location yet at the newer and
+// older element, for differences found within that element.
+func (d DifferenceList) at(c Comparer, newer, older interface{}) DifferenceList {
+	for _, list := range [][]Difference{d.Error, d.Warning} {
+		for i := range list {
+			if list[i].NewLocation == nil && list[i].OldLocation == nil {
+				list[i].at(c, newer, older)
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,165 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"strings"
+)
+
+// symbolTable maps the fully qualified name of every message, enum, service
+// and extension of a FileDescriptorSet, such as .foo.v1.User, to its
+// descriptor. Names are qualified by package and enclosing messages the way
+// protoc writes them into TypeName and Extendee. Missing descriptors are
+// skipped, validate reports them. The set itself is never changed.
+type symbolTable struct {
+	messages   map[string]*descriptor.DescriptorProto
+	enums      map[string]*descriptor.EnumDescriptorProto
+	services   map[string]*descriptor.ServiceDescriptorProto
+	extensions map[string]*descriptor.FieldDescriptorProto
+	names      map[interface{}]string                                             // fully qualified name of every symbol
+	extended   map[*descriptor.DescriptorProto][]*descriptor.FieldDescriptorProto // extensions of every message, in declaration order
+}
+
+func newSymbolTable(set *descriptor.FileDescriptorSet) *symbolTable {
+	s := &symbolTable{
+		messages:   make(map[string]*descriptor.DescriptorProto),
+		enums:      make(map[string]*descriptor.EnumDescriptorProto),
+		services:   make(map[string]*descriptor.ServiceDescriptorProto),
+		extensions: make(map[string]*descriptor.FieldDescriptorProto),
+		names:      make(map[interface{}]string),
+		extended:   make(map[*descriptor.DescriptorProto][]*descriptor.FieldDescriptorProto),
+	}
+	if set == nil {
+		return s
+	}
+	for _, file := range set.File {
+		if file == nil {
+			continue
+		}
+		scope := packageScope(file)
+		for _, message := range file.MessageType {
+			s.addMessage(message, scope)
+		}
+		for _, enum := range file.EnumType {
+			s.addEnum(enum, scope)
+		}
+		for _, ext := range file.Extension {
+			s.addExtension(ext, scope)
+		}
+		for _, service := range file.Service {
+			if service == nil {
+				continue
+			}
+			s.services[scope+"."+service.GetName()] = service
+			s.names[service] = scope + "." + service.GetName()
+		}
+	}
+	for _, file := range set.File { //extendees may be declared after their extensions
+		if file == nil {
+			continue
+		}
+		s.extend(file.Extension)
+		for _, message := range file.MessageType {
+			s.extendNested(message)
+		}
+	}
+	return s
+}
+
+func (s *symbolTable) extend(exts []*descriptor.FieldDescriptorProto) {
+	for _, ext := range exts {
+		if ext == nil {
+			continue
+		}
+		if d := s.message(ext.GetExtendee()); d != nil {
+			s.extended[d] = append(s.extended[d], ext)
+		}
+	}
+}
+
+func (s *symbolTable) extendNested(d *descriptor.DescriptorProto) {
+	if d == nil {
+		return
+	}
+	s.extend(d.Extension)
+	for _, msg := range d.NestedType {
+		s.extendNested(msg)
+	}
+}
+
+func (s *symbolTable) addMessage(d *descriptor.DescriptorProto, scope string) {
+	if d == nil {
+		return
+	}
+	name := scope + "." + d.GetName()
+	s.messages[name] = d
+	s.names[d] = name
+	for _, msg := range d.NestedType {
+		s.addMessage(msg, name)
+	}
+	for _, enum := range d.EnumType {
+		s.addEnum(enum, name)
+	}
+	for _, ext := range d.Extension {
+		s.addExtension(ext, name)
+	}
+}
+
+func (s *symbolTable) addEnum(enum *descriptor.EnumDescriptorProto, scope string) {
+	if enum == nil {
+		return
+	}
+	s.enums[scope+"."+enum.GetName()] = enum
+	s.names[enum] = scope + "." + enum.GetName()
+}
+
+func (s *symbolTable) addExtension(ext *descriptor.FieldDescriptorProto, scope string) {
+	if ext == nil {
+		return
+	}
+	s.extensions[scope+"."+ext.GetName()] = ext
+	s.names[ext] = scope + "." + ext.GetName()
+}
+
+// qualify adds the leading dot protoc uses for fully qualified names.
+func qualify(name string) string {
+	if strings.HasPrefix(name, ".") {
+		return name
+	}
+	return "." + name
+}
+
+// message returns the message with the given fully qualified name, or nil.
+func (s *symbolTable) message(name string) *descriptor.DescriptorProto {
+	return s.messages[qualify(name)]
+}
+
+// enum returns the enum with the given fully qualified name, or nil.
+func (s *symbolTable) enum(name string) *descriptor.EnumDescriptorProto {
+	return s.enums[qualify(name)]
+}
+
+// fields returns the fields of d followed by its extensions declared anywhere
+// in the set, leaving d.Field untouched.
+func (s *symbolTable) fields(d *descriptor.DescriptorProto) []*descriptor.FieldDescriptorProto {
+	exts := s.extended[d]
+	if len(exts) == 0 {
+		return d.Field
+	}
+	fields := make([]*descriptor.FieldDescriptorProto, 0, len(d.Field)+len(exts))
+	fields = append(fields, d.Field...)
+	return append(fields, exts...)
+}
@@ -0,0 +1,89 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+)
+
+// messagePair is a newer and an older message compared with each other
+// because a field changed its type from one to the other.
+type messagePair struct {
+	newer, older *descriptor.DescriptorProto
+}
+
+// typePairs memoises the message pairs reached through fields whose type
+// changed. Every pair is compared once, no matter how many fields reach it,
+// which also ends the traversal of recursive and mutually recursive types.
+type typePairs struct {
+	order []messagePair
+	names map[messagePair]string   // fully qualified name of the newer message
+	via   map[messagePair][]string // paths of the fields reaching the pair
+	done  map[messagePair]bool     // pairs already compared as a rename
+}
+
+func newTypePairs() *typePairs {
+	return &typePairs{names: make(map[messagePair]string), via: make(map[messagePair][]string), done: make(map[messagePair]bool)}
+}
+
+// renamed records that newer is older under a new name, whose differences
+// are reported with the rename rather than through the fields reaching it.
+func (t *typePairs) renamed(newer, older *descriptor.DescriptorProto) {
+	t.done[messagePair{newer, older}] = true
+}
+
+// reach records that the field at path changed its type from older to
+// newer, whose fully qualified name is name.
+func (t *typePairs) reach(newer, older *descriptor.DescriptorProto, name, path string) {
+	p := messagePair{newer, older}
+	if _, ok := t.names[p]; !ok {
+		t.order = append(t.order, p)
+		t.names[p] = name
+	}
+	for _, v := range t.via[p] {
+		if v == path {
+			return
+		}
+	}
+	t.via[p] = append(t.via[p], path)
+}
+
+// compareTypePairs compares every pair reached so far, including the pairs
+// reached while doing so, and returns their differences along with the
+// paths reaching them.
+func compareTypePairs(c Comparer) DifferenceList {
+	var results []DifferenceList
+	for i := 0; i < len(c.pairs.order); i++ {
+		p := c.pairs.order[i]
+		if c.pairs.done[p] {
+			results = append(results, DifferenceList{})
+			continue
+		}
+		d := compareMessages(p.newer, p.older, c.pairs.names[p], c)
+		d.inFile(c.files[p.newer].GetName())
+		results = append(results, d)
+	}
+	var output DifferenceList
+	for i, d := range results {
+		via := c.pairs.via[c.pairs.order[i]]
+		for _, list := range [][]Difference{d.Error, d.Warning} {
+			for j := range list {
+				list[j].Via = append(list[j].Via, via...)
+			}
+		}
+		output.merge(d)
+	}
+	return output
+}
@@ -0,0 +1,99 @@
+// Copyright [2015] [Ignazio Ferreira]
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compatibility
+
+import (
+	descriptor "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+)
+
+// typeSafety tells whether a field keeps its values when it changes its type.
+type typeSafety int
+
+const (
+	// incompatibleType is a change between types of different wire types,
+	// or of the same wire type but different meanings, such as fixed32 and
+	// float.
+	incompatibleType typeSafety = iota
+	// wireSafeType is a change readers of either type handle without
+	// changing values, under the conditions given by its caveat.
+	wireSafeType
+	// lossyType is a change readers of either type can parse, but which may
+	// truncate values or change their sign.
+	lossyType
+)
+
+// typeChange is a change between two field types that can be read on the
+// wire, in either direction.
+type typeChange struct {
+	a, b   descriptor.FieldDescriptorProto_Type
+	safety typeSafety
+	caveat string
+}
+
+const (
+	enumCaveat = ", enums are encoded as int32 and readers of the enum treat numbers it does not declare as unknown values"
+	boolCaveat = ", readers of bool read every value other than 0 as true"
+	signCaveat = ", negative values change sign"
+)
+
+// typeChanges lists every change between field types that can be read on the
+// wire, and incompatible changes that need an explanation. Changes missing
+// from it are incompatible.
+var typeChanges = []typeChange{
+	{descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_INT64, lossyType, ", readers of int32 truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_UINT32, lossyType, signCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_UINT64, lossyType, signCaveat + " and readers of int32 truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_BOOL, lossyType, boolCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_UINT32, lossyType, signCaveat + " and readers of uint32 truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_UINT64, lossyType, signCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_BOOL, lossyType, boolCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_UINT64, lossyType, ", readers of uint32 truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_BOOL, lossyType, boolCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_BOOL, lossyType, boolCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_ENUM, descriptor.FieldDescriptorProto_TYPE_INT32, wireSafeType, enumCaveat},
+	{descriptor.FieldDescriptorProto_TYPE_ENUM, descriptor.FieldDescriptorProto_TYPE_INT64, lossyType, enumCaveat + ", and readers of the enum truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_ENUM, descriptor.FieldDescriptorProto_TYPE_UINT32, lossyType, enumCaveat + ", and negative values change sign"},
+	{descriptor.FieldDescriptorProto_TYPE_ENUM, descriptor.FieldDescriptorProto_TYPE_UINT64, lossyType, enumCaveat + ", negative values change sign and readers of the enum truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_SINT32, descriptor.FieldDescriptorProto_TYPE_SINT64, lossyType, ", readers of sint32 truncate values beyond 32 bits"},
+	{descriptor.FieldDescriptorProto_TYPE_FIXED32, descriptor.FieldDescriptorProto_TYPE_SFIXED32, lossyType, ", values above 2147483647 change sign"},
+	{descriptor.FieldDescriptorProto_TYPE_FIXED64, descriptor.FieldDescriptorProto_TYPE_SFIXED64, lossyType, ", values above 9223372036854775807 change sign"},
+	{descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES, wireSafeType, ", as long as the bytes are valid UTF-8"},
+	{descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_BYTES, wireSafeType, ", which is only compatible if the bytes hold an encoded message of this type"},
+	{descriptor.FieldDescriptorProto_TYPE_GROUP, descriptor.FieldDescriptorProto_TYPE_MESSAGE, incompatibleType, ", groups are delimited by start and end group tags and messages are length prefixed, so readers treat the field written by the other version as unknown and drop it"},
+}
+
+// classifyType looks up a change between two different field types in
+// typeChanges, and returns how safe it is along with its caveat.
+func classifyType(newer, older descriptor.FieldDescriptorProto_Type) (typeSafety, string) {
+	for _, change := range typeChanges {
+		if (change.a == newer && change.b == older) || (change.a == older && change.b == newer) {
+			return change.safety, change.caveat
+		}
+	}
+	return incompatibleType, ""
+}
+
+// addTypeChange reports a change of the type of a field, or of a map key or
+// value, with the severity of its safety.
+func (d *DifferenceList) addTypeChange(c Condition, newer, older descriptor.FieldDescriptorProto_Type, path, qualifier string) *Difference {
+	safety, caveat := classifyType(newer, older)
+	switch safety {
+	case wireSafeType:
+		return d.addWarning(c, newer.String(), older.String(), path, qualifier, caveat)
+	case lossyType:
+		return d.addLossy(c, newer.String(), older.String(), path, qualifier, caveat)
+	}
+	return d.addError(c, newer.String(), older.String(), path, qualifier, caveat)
+}